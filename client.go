@@ -2,12 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // Message represents a chat message
@@ -17,6 +25,66 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	Reasoning  string     `json:"reasoning,omitempty"` // Some models (o1, deepseek) use this field
+
+	// ReasoningContent is the thinking DeepSeek-style reasoning models
+	// return alongside the answer. It is never sent back to the API.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+
+	// Images are data URLs sent after Content as image_url content parts
+	Images []string `json:"-"`
+
+	// Pinned is the file a tool result holds when it is kept through
+	// compaction; see pinnedFile
+	Pinned string `json:"-"`
+
+	// Continuation marks the continuePrompt nudge sent when an answer hit
+	// the token limit; it isn't a question
+	Continuation bool `json:"-"`
+}
+
+// isQuestion reports whether m is a question the user asked
+func (m Message) isQuestion() bool {
+	return m.Role == "user" && !m.Continuation
+}
+
+// Thinking returns the reasoning a model showed before its answer, from
+// whichever field the provider uses
+func (m Message) Thinking() string {
+	if m.ReasoningContent != "" {
+		return m.ReasoningContent
+	}
+	return m.Reasoning
+}
+
+// ContentPart is one element of a message's content when it has images
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is the image of an image_url content part
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON sends content as a string, or as an array of text and
+// image_url parts when the message has images
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	// Providers reject reasoning_content in requests
+	m.ReasoningContent = ""
+	if len(m.Images) == 0 {
+		return json.Marshal(message(m))
+	}
+	parts := []ContentPart{{Type: "text", Text: m.Content}}
+	for _, url := range m.Images {
+		parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}})
+	}
+	return json.Marshal(struct {
+		message
+		Content []ContentPart `json:"content"`
+	}{message(m), parts})
 }
 
 // ToolCall represents a function call from the model
@@ -31,9 +99,50 @@ type ToolCall struct {
 
 // ChatRequest is the request body for chat completions
 type ChatRequest struct {
-	Model    string                   `json:"model"`
-	Messages []Message                `json:"messages"`
-	Tools    []map[string]interface{} `json:"tools,omitempty"`
+	Model           string                   `json:"model"`
+	Messages        []Message                `json:"messages"`
+	Tools           []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice      interface{}              `json:"tool_choice,omitempty"`
+	ReasoningEffort string                   `json:"reasoning_effort,omitempty"`
+	Seed            int                      `json:"seed,omitempty"`
+
+	// ExtraParams are added to the body for provider parameters without a
+	// field here; see MarshalJSON
+	ExtraParams map[string]interface{} `json:"-"`
+}
+
+// Request fields extra_params may not set even when they are empty
+var reservedRequestParams = map[string]bool{
+	"model":       true,
+	"messages":    true,
+	"tools":       true,
+	"tool_choice": true,
+	"stream":      true,
+}
+
+// MarshalJSON adds ExtraParams to the request body. Fields that are set,
+// and the reserved ones, keep their values.
+func (r ChatRequest) MarshalJSON() ([]byte, error) {
+	type request ChatRequest
+	data, err := json.Marshal(request(r))
+	if err != nil || len(r.ExtraParams) == 0 {
+		return data, err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	for key, value := range r.ExtraParams {
+		if _, set := body[key]; set || reservedRequestParams[key] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("extra_params %s: %v", key, err)
+		}
+		body[key] = raw
+	}
+	return json.Marshal(body)
 }
 
 // ChatResponse is the response from chat completions
@@ -43,32 +152,86 @@ type ChatResponse struct {
 		Message      Message `json:"message"`
 		FinishReason string  `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 	} `json:"error,omitempty"`
 }
 
-// Client handles communication with OpenAI-compatible APIs
-type Client struct {
-	config   *Config
-	http     *http.Client
-	messages []Message
+// APIError is a non-success response from the API. Type and Message come
+// from the provider's error body when it has one.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
 }
 
-// NewClient creates a new API client
-func NewClient(cfg *Config) *Client {
-	return &Client{
-		config: cfg,
-		http: &http.Client{
-			Timeout: 120 * time.Second,
-		},
-		messages: []Message{
-			{
-				Role: "system",
-				Content: `You are a helpful assistant that answers questions about codebases.
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("API error: %s", e.Message)
+	}
+	if e.Type != "" {
+		return fmt.Sprintf("API returned status %d (%s): %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// newAPIError builds an APIError from a response, falling back to the raw
+// body as the message when it isn't an OpenAI-style error object
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Message: string(body)}
+	var parsed ChatResponse
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error != nil {
+		apiErr.Type = parsed.Error.Type
+		apiErr.Message = parsed.Error.Message
+	}
+	return apiErr
+}
+
+// ErrContextExceeded is returned when the conversation no longer fits in
+// the model's context window
+var ErrContextExceeded = errors.New("the conversation is too long for the model's context window")
+
+// Phrases providers use when a request exceeds the context window
+var contextExceededPhrases = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// checkContextExceeded wraps apiErr in ErrContextExceeded when it reports
+// an over-long request, and returns it unchanged otherwise
+func checkContextExceeded(apiErr *APIError) error {
+	text := strings.ToLower(apiErr.Type + " " + apiErr.Message)
+	for _, phrase := range contextExceededPhrases {
+		if strings.Contains(text, phrase) {
+			return fmt.Errorf("%w (%w)", ErrContextExceeded, apiErr)
+		}
+	}
+	return apiErr
+}
+
+// Usage reports token counts for a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add accumulates token counts from another request
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// defaultSystemPrompt is used unless the project provides .codequery/system.md
+const defaultSystemPrompt = `You are a helpful assistant that answers questions about codebases.
 You have access to tools that let you explore the file system: ls, cat, head, grep, find, and tree.
-You can also create markdown documentation files using the write_markdown tool.
+You can also create markdown documentation files using the write_markdown tool and change existing ones with edit_markdown.
 
 IMPORTANT: You MUST use the tool calling feature to invoke tools. Do NOT write JSON or function calls in your response text. Use the tool_calls mechanism provided by the API.
 
@@ -126,29 +289,222 @@ Make a step by step plan of what tools you will use and why before starting tool
 
 ---
 
+Tool results arrive as a JSON object. "output" holds what the tool printed; "truncated" is true when the output was cut off (read the rest with head, tail, or read_chunk); "summarized" is true when a long output was replaced by a summary (read specific parts with head, grep_context, or read_chunk); "exit_code" is the command's exit status when it was not 0 (grep exits 1 when nothing matched); "error" says why the call failed.
+
 Always use the tools to verify your answers - don't guess about code you haven't read.
-When you have enough information, respond with your final answer in plain text.`,
+When you have enough information, respond with your final answer in plain text.`
+
+// Client handles communication with OpenAI-compatible APIs
+type Client struct {
+	config   *Config
+	http     *http.Client
+	mu       sync.Mutex // Guards messages, usage, turn, question, images, toolChoice, and lastRequest
+	messages []Message
+	usage    Usage    // Token usage of the most recent Chat call
+	turn     int      // Index of the user message that started the last Chat call
+	question string   // Message passed to the most recent Chat call
+	images   []string // Attached to the next question (AttachImage)
+
+	basePrompt  string         // System prompt before the answer style is added
+	cache       *responseCache // Responses to identical requests; nil when disabled
+	toolStart   ToolStartFunc  // Called before each tool runs; may be nil
+	stats       ToolStats      // Tool calls made this session
+	summarize   func(ctx context.Context, prompt, text string) (string, error)
+	toolChoice  string    // Tool to force on the next request; empty means auto
+	lastRequest time.Time // When the previous request was dispatched, for throttling
+}
+
+// NewClient creates a new API client
+func NewClient(cfg *Config) *Client {
+	systemPrompt := defaultSystemPrompt
+	if cfg.SystemPrompt != "" {
+		systemPrompt = cfg.SystemPrompt
+	}
+	if cfg.SystemAppend != "" {
+		systemPrompt += "\n\n" + strings.TrimSpace(cfg.SystemAppend)
+	}
+	if cfg.EncodeBinaryResults {
+		systemPrompt += "\n\n" + binaryResultPrompt
+	}
+
+	client := &Client{
+		config:     cfg,
+		basePrompt: systemPrompt,
+		http: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+		messages: []Message{
+			{
+				Role:    "system",
+				Content: withStyle(systemPrompt, cfg.Style),
 			},
 		},
 	}
+	client.summarize = client.summarizeWithModel
+	if cfg.ResponseCache || cfg.CacheFile != "" {
+		client.cache = newResponseCache(cfg.CacheFile, time.Duration(cfg.ResponseCacheTTL)*time.Second)
+	}
+	return client
+}
+
+// AddContext appends a message ahead of the next question, e.g. input
+// piped on stdin
+func (c *Client) AddContext(msg Message) {
+	c.appendMessage(msg)
+}
+
+// appendMessage adds msg to the conversation history. A pinned result
+// replaces earlier pins of the same file, so only its latest contents are kept.
+func (c *Client) appendMessage(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if msg.Pinned != "" {
+		for i := range c.messages {
+			if c.messages[i].Pinned == msg.Pinned {
+				c.messages[i].Pinned = ""
+			}
+		}
+	}
+	c.messages = append(c.messages, msg)
+}
+
+// Messages returns a copy of the conversation history, starting with the
+// system message
+func (c *Client) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Tool-calling rounds allowed per question when the config doesn't set a limit
+const defaultMaxToolIterations = 25
+
+// Requests made to finish one answer cut off at the token limit when
+// auto_continue is on
+const maxContinuations = 3
+
+// continuePrompt asks the model to pick up an answer cut off at the token limit
+const continuePrompt = "Your answer was cut off. Continue exactly where it stopped, without repeating anything."
+
+// Added to an answer cut off at the token limit that wasn't continued
+const lengthTruncationNotice = "\n\n[response truncated due to length]"
+
+// Markers around a base64-encoded tool result
+const (
+	base64ResultStart = "[base64]"
+	base64ResultEnd   = "[/base64]"
+)
+
+// binaryResultPrompt tells the model how to read encoded tool results
+const binaryResultPrompt = "Tool results that contain binary data or control characters are base64-encoded between " +
+	base64ResultStart + " and " + base64ResultEnd + " lines. Decode them to read the original bytes."
+
+// hasNonPrintable reports whether s has bytes that don't survive as JSON
+// text: invalid UTF-8 or control characters other than tab and newlines
+func hasNonPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeToolResult wraps a result as base64 between marker lines
+func encodeToolResult(result string) string {
+	return base64ResultStart + "\n" + base64.StdEncoding.EncodeToString([]byte(result)) + "\n" + base64ResultEnd
+}
+
+// decodeToolResult reverses encodeToolResult; other results are returned as is
+func decodeToolResult(result string) (string, error) {
+	if !strings.HasPrefix(result, base64ResultStart+"\n") || !strings.HasSuffix(result, "\n"+base64ResultEnd) {
+		return result, nil
+	}
+	encoded := strings.TrimSuffix(strings.TrimPrefix(result, base64ResultStart+"\n"), "\n"+base64ResultEnd)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 tool result: %v", err)
+	}
+	return string(data), nil
 }
 
 // ToolCallback is called for each tool execution with name, raw args JSON, and result
 type ToolCallback func(name, argsJSON, result string)
 
-// Chat sends a message and handles tool calls in a loop
-func (c *Client) Chat(userMessage string, onToolCall ToolCallback) (string, error) {
+// ToolStartFunc is called before a tool runs; the returned function is
+// called once it finishes
+type ToolStartFunc func(name, argsJSON string) (done func())
+
+// SetToolStart registers a function called before each tool runs, e.g. to
+// show progress for slow tools
+func (c *Client) SetToolStart(fn ToolStartFunc) {
+	c.toolStart = fn
+}
+
+// Chat sends a message and handles tool calls in a loop. Cancelling ctx
+// aborts the in-flight request and stops before running further tools; the
+// question and everything it added are then dropped from history, so no
+// tool call is left without its result.
+func (c *Client) Chat(ctx context.Context, userMessage string, onToolCall ToolCallback) (string, error) {
+	answer, err := c.chat(ctx, userMessage, onToolCall)
+	if err != nil && ctx.Err() != nil {
+		c.discardTurn()
+		return "", ctx.Err()
+	}
+	return answer, err
+}
+
+// discardTurn removes the messages added by the current Chat call
+func (c *Client) discardTurn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.turn > 0 && c.turn <= len(c.messages) {
+		c.messages = c.messages[:c.turn]
+	}
+	c.turn = 0
+}
+
+func (c *Client) chat(ctx context.Context, userMessage string, onToolCall ToolCallback) (string, error) {
 	// Add user message to history
+	if after := c.config.AutoCompactAfter; after > 0 && len(c.Messages()) > after {
+		if err := c.Compact(ctx); err != nil && debugMode {
+			fmt.Printf("[debug] Compacting conversation failed: %v\n", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.question = userMessage
+	c.turn = len(c.messages)
 	c.messages = append(c.messages, Message{
 		Role:    "user",
 		Content: userMessage,
+		Images:  c.images,
 	})
+	c.images = nil
+	c.usage = Usage{}
+	c.mu.Unlock()
+
+	maxIterations := c.config.MaxToolIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultMaxToolIterations
+	}
+	iterations := 0
+	partial := ""
+	// Earlier parts of an answer cut off at the token limit
+	answer := ""
+	continuations := 0
 
 	for {
-		resp, err := c.sendRequest()
+		resp, err := c.sendRequest(ctx)
 		if err != nil {
 			return "", err
 		}
+		if resp.Usage != nil {
+			c.addUsage(*resp.Usage)
+		}
 
 		if len(resp.Choices) == 0 {
 			return "", fmt.Errorf("no response from model")
@@ -156,52 +512,421 @@ func (c *Client) Chat(userMessage string, onToolCall ToolCallback) (string, erro
 
 		choice := resp.Choices[0]
 		assistantMsg := choice.Message
+		if thinking := assistantMsg.Thinking(); debugMode && thinking != "" {
+			PrintThinking(thinking)
+		}
+
+		// Some small models write the call into the content instead of tool_calls
+		if c.config.Lenient && len(assistantMsg.ToolCalls) == 0 {
+			if tc, ok := parseLeakedToolCall(assistantMsg.Content); ok {
+				tc.ID = fmt.Sprintf("leaked_%d", len(c.Messages()))
+				assistantMsg.ToolCalls = []ToolCall{tc}
+				assistantMsg.Content = ""
+			}
+		}
+
+		if len(assistantMsg.ToolCalls) > 0 {
+			// Stop a model that never converges. The unanswered tool calls are
+			// left out of history so the next request stays valid.
+			if iterations >= maxIterations {
+				if assistantMsg.Content != "" {
+					partial = assistantMsg.Content
+				}
+				return partial, fmt.Errorf("exceeded maximum tool iterations (%d)", maxIterations)
+			}
+			iterations++
+			if assistantMsg.Content != "" {
+				partial = assistantMsg.Content
+			}
+		}
 
 		// Add assistant message to history
-		c.messages = append(c.messages, assistantMsg)
+		c.appendMessage(assistantMsg)
 
 		// If there are tool calls, execute them
 		if len(assistantMsg.ToolCalls) > 0 {
+			// Identical calls in one message run once; each call ID still gets a result
+			results := make(map[string]ToolResult)
 			for _, tc := range assistantMsg.ToolCalls {
-				// Execute the tool
-				result, err := ExecuteTool(tc.Function.Name, tc.Function.Arguments)
-				if err != nil {
-					result = fmt.Sprintf("Error: %v", err)
+				if ctx.Err() != nil {
+					return "", ctx.Err()
 				}
 
-				// Notify about tool call with result
-				if onToolCall != nil {
-					onToolCall(tc.Function.Name, tc.Function.Arguments, result)
+				key := tc.Function.Name + "\x00" + tc.Function.Arguments
+				result, duplicate := results[key]
+				if !duplicate {
+					// Execute the tool
+					var done func()
+					if c.toolStart != nil {
+						done = c.toolStart(tc.Function.Name, tc.Function.Arguments)
+					}
+					started := time.Now()
+					result = RunTool(tc.Function.Name, tc.Function.Arguments)
+					c.stats.Record(tc.Function.Name, time.Since(started))
+					if done != nil {
+						done()
+					}
+					result = c.summarizeResult(ctx, result)
+					// Spell out the schema so the model doesn't repeat the mistake
+					if hint := toolSchemaHint(tc.Function.Name); hint != "" && errors.Is(result.Err, errInvalidArguments) {
+						result.Err = fmt.Errorf("%w\n%s", result.Err, hint)
+					}
+					if c.config.EncodeBinaryResults && hasNonPrintable(result.Output) {
+						result.Output = encodeToolResult(result.Output)
+					}
+					results[key] = result
+
+					// Notify about tool call with result
+					if onToolCall != nil {
+						onToolCall(tc.Function.Name, tc.Function.Arguments, result.String())
+					}
 				}
 
 				// Add tool result to history
-				c.messages = append(c.messages, Message{
+				msg := Message{
 					Role:       "tool",
-					Content:    result,
+					Content:    result.JSON(),
 					ToolCallID: tc.ID,
-				})
+				}
+				if c.config.LabelToolResults {
+					msg.Content = toolResultHeader(tc.Function.Name, tc.Function.Arguments) + "\n" + msg.Content
+				}
+				if result.Err == nil {
+					msg.Pinned = pinnedFile(userMessage, tc.Function.Name, tc.Function.Arguments)
+				}
+				c.appendMessage(msg)
 			}
 			// Continue the loop to get the next response
 			continue
 		}
 
-		// No more tool calls, return the final response
-		// Some reasoning models (o1, deepseek, etc.) put response in "reasoning" field
+		// No more tool calls, return the final response. The thinking is
+		// only the answer when some reasoning models (o1, deepseek, etc.)
+		// leave the content empty.
 		response := assistantMsg.Content
-		if response == "" && assistantMsg.Reasoning != "" {
-			response = assistantMsg.Reasoning
+		if response == "" {
+			response = assistantMsg.Thinking()
+		}
+		answer += response
+		if choice.FinishReason == "length" {
+			if !c.config.AutoContinue || continuations >= maxContinuations {
+				return answer + lengthTruncationNotice, nil
+			}
+			continuations++
+			c.appendMessage(Message{Role: "user", Content: continuePrompt, Continuation: true})
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// Tool output length above which -auto-summarize replaces it with a summary
+const defaultSummarizeThreshold = 20000
+
+// summarizePrompt instructs the summarizer model
+const summarizePrompt = "Summarize this tool output for another assistant that is answering a question about a codebase. " +
+	"Keep file paths, line numbers, identifiers, versions, and error messages exactly as written. Leave out repetitive or boilerplate content."
+
+// summarizeWithModel asks the summarizer model (the main model when
+// summarize_model isn't set) to condense text as prompt instructs
+func (c *Client) summarizeWithModel(ctx context.Context, prompt, text string) (string, error) {
+	model := c.config.SummarizeModel
+	if model == "" {
+		model = c.config.Model
+	}
+	resp, err := c.postChat(ctx, ChatRequest{
+		Model: model,
+		Messages: []Message{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	if resp.Usage != nil {
+		c.addUsage(*resp.Usage)
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// summarizeResult replaces a tool result longer than the threshold with a
+// summary when auto_summarize is on. The original is kept if summarizing fails.
+func (c *Client) summarizeResult(ctx context.Context, result ToolResult) ToolResult {
+	threshold := c.config.SummarizeThreshold
+	if threshold <= 0 {
+		threshold = defaultSummarizeThreshold
+	}
+	if !c.config.AutoSummarize || result.Err != nil || len(result.Output) <= threshold {
+		return result
+	}
+	summary, err := c.summarize(ctx, summarizePrompt, result.Output)
+	if err != nil {
+		if debugMode {
+			fmt.Printf("[debug] Summarizing tool output failed: %v\n", err)
+		}
+		return result
+	}
+	result.Output = summary
+	result.Summarized = true
+	return result
+}
+
+// Questions kept word for word, with their tool calls, when the conversation is compacted
+const compactKeepTurns = 2
+
+// compactPrompt instructs the summarizer when compacting the conversation
+const compactPrompt = "Summarize this conversation about a codebase so it can continue without the original messages. " +
+	"Keep the questions asked, the answers given, and the file paths, identifiers, and facts they relied on."
+
+// compactResultLength limits how much of each tool result goes into the compaction transcript
+const compactResultLength = 2000
+
+// Compact replaces all but the last few questions and their tool calls with
+// a summary in a system message, keeping the system prompt and pinned tool
+// results. It does nothing when there are no older questions to summarize.
+func (c *Client) Compact(ctx context.Context) error {
+	c.mu.Lock()
+	var questions []int
+	for i, msg := range c.messages {
+		if msg.isQuestion() && i > 0 {
+			questions = append(questions, i)
+		}
+	}
+	if len(questions) <= compactKeepTurns {
+		c.mu.Unlock()
+		return nil
+	}
+	keep := questions[len(questions)-compactKeepTurns]
+	transcript := compactTranscript(c.messages[1:keep])
+	pinned := pinnedMessages(c.messages[1:keep])
+	c.mu.Unlock()
+
+	summary, err := c.summarize(ctx, compactPrompt, transcript)
+	if err != nil {
+		return fmt.Errorf("summarizing conversation: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if keep > len(c.messages) {
+		return nil // Reset while summarizing
+	}
+	note := Message{Role: "system", Content: "Summary of the earlier conversation:\n\n" + summary}
+	compacted := append([]Message{c.messages[0], note}, pinned...)
+	c.messages = append(compacted, c.messages[keep:]...)
+	if c.turn >= keep {
+		c.turn -= keep - len(compacted)
+	} else {
+		c.turn = 0
+	}
+	return nil
+}
+
+// pinnedFile returns the file a cat call read when a word of the question
+// names it, by path or by file name, so its contents survive compaction. Other calls
+// return "".
+func pinnedFile(question, name, argsJSON string) string {
+	if name != "cat" {
+		return ""
+	}
+	var args map[string]interface{}
+	if json.Unmarshal([]byte(argsJSON), &args) != nil {
+		return ""
+	}
+	path := getString(args, "path", "")
+	if path == "" {
+		return ""
+	}
+	path = filepath.Clean(path)
+	base := filepath.Base(path)
+	for _, word := range strings.Fields(question) {
+		word = strings.TrimRight(strings.Trim(word, "`'\"()[],:;!?"), ".")
+		if word == "" {
+			continue
+		}
+		word = filepath.Clean(word)
+		if word == path || word == base {
+			return path
+		}
+	}
+	return ""
+}
+
+// pinnedMessages returns the pinned tool results in messages, each after a
+// copy of the assistant message that called it trimmed to that call, so the
+// kept history stays valid for the API
+func pinnedMessages(messages []Message) []Message {
+	calls := make(map[string]ToolCall)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = tc
+		}
+	}
+	var pinned []Message
+	for _, msg := range messages {
+		if msg.Role != "tool" || msg.Pinned == "" {
+			continue
+		}
+		if tc, ok := calls[msg.ToolCallID]; ok {
+			pinned = append(pinned, Message{Role: "assistant", ToolCalls: []ToolCall{tc}}, msg)
+		}
+	}
+	return pinned
+}
+
+// compactTranscript renders messages as plain text for the summarizer
+func compactTranscript(messages []Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			if msg.Continuation {
+				continue
+			}
+			fmt.Fprintf(&b, "User: %s\n\n", msg.Content)
+		case "assistant":
+			for _, tc := range msg.ToolCalls {
+				fmt.Fprintf(&b, "Tool call: %s %s\n\n", tc.Function.Name, FormatToolCall(tc.Function.Name, tc.Function.Arguments))
+			}
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "Assistant: %s\n\n", msg.Content)
+			}
+		case "tool":
+			content := msg.Content
+			if result, ok := parseToolResult(content); ok {
+				content = result.String()
+			}
+			if len(content) > compactResultLength {
+				content = content[:compactResultLength] + "..."
+			}
+			fmt.Fprintf(&b, "Tool result: %s\n\n", content)
+		case "system":
+			fmt.Fprintf(&b, "%s\n\n", msg.Content)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// parseLeakedToolCall recognizes content that is only a tool call written as
+// JSON, e.g. {"name": "cat", "arguments": {"path": "main.go"}}, optionally in
+// a code fence. The tool must exist and every argument must be one of its
+// parameters.
+func parseLeakedToolCall(content string) (ToolCall, bool) {
+	var tc ToolCall
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(strings.TrimPrefix(content, "```json"), "```")
+		content = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+	}
+	if !strings.HasPrefix(content, "{") || !strings.HasSuffix(content, "}") {
+		return tc, false
+	}
+
+	var leaked struct {
+		Name       string          `json:"name"`
+		Arguments  json.RawMessage `json:"arguments"`
+		Parameters json.RawMessage `json:"parameters"`
+		Function   *struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal([]byte(content), &leaked); err != nil {
+		return tc, false
+	}
+	name, rawArgs := leaked.Name, leaked.Arguments
+	if leaked.Function != nil {
+		name, rawArgs = leaked.Function.Name, leaked.Function.Arguments
+	}
+	if rawArgs == nil {
+		rawArgs = leaked.Parameters
+	}
+
+	props := toolProperties(name)
+	if props == nil {
+		return tc, false
+	}
+
+	// Arguments may be an object or a JSON-encoded string, as in tool_calls
+	var argsJSON string
+	if err := json.Unmarshal(rawArgs, &argsJSON); err != nil {
+		argsJSON = string(rawArgs)
+	}
+	if argsJSON == "" || argsJSON == "null" {
+		argsJSON = "{}"
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return tc, false
+	}
+	for key := range args {
+		if _, ok := props[key]; !ok {
+			return tc, false
 		}
-		return response, nil
 	}
+
+	tc.Type = "function"
+	tc.Function.Name = name
+	tc.Function.Arguments = argsJSON
+	return tc, true
 }
 
-func (c *Client) sendRequest() (*ChatResponse, error) {
+func (c *Client) sendRequest(ctx context.Context) (*ChatResponse, error) {
 	reqBody := ChatRequest{
-		Model:    c.config.Model,
-		Messages: c.messages,
-		Tools:    ToolDefinitions,
+		Model:           c.config.Model,
+		Messages:        c.Messages(),
+		Tools:           EnabledTools(),
+		ReasoningEffort: c.config.ReasoningEffort,
+		Seed:            c.config.Seed,
+		ExtraParams:     c.config.ExtraParams,
+	}
+
+	// A forced tool choice only applies to one request, then falls back to auto
+	c.mu.Lock()
+	toolChoice := c.toolChoice
+	c.toolChoice = ""
+	c.mu.Unlock()
+	if toolChoice != "" {
+		reqBody.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": toolChoice},
+		}
+	}
+
+	return c.postChat(ctx, reqBody)
+}
+
+// How much of a non-JSON response is quoted in the error
+const nonJSONExcerptLength = 200
+
+// checkJSONResponse recognizes a successful response that isn't JSON at
+// all, which usually means base_url points at a web page or a server that
+// isn't OpenAI-compatible, so it isn't reported as a parse error
+func checkJSONResponse(url, contentType string, body []byte) error {
+	const hint = "check that base_url points at an OpenAI-compatible API (it usually ends in /v1)"
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "text/html") || bytes.HasPrefix(body, []byte("<")) {
+		return fmt.Errorf("%s returned an HTML page instead of JSON; %s", url, hint)
 	}
+	if len(body) > 0 && body[0] != '{' {
+		excerpt := string(body)
+		if len(excerpt) > nonJSONExcerptLength {
+			excerpt = excerpt[:nonJSONExcerptLength] + "..."
+		}
+		if contentType == "" {
+			contentType = "unknown content type"
+		}
+		return fmt.Errorf("%s returned a non-JSON response (%s); %s\nBody: %s", url, contentType, hint, excerpt)
+	}
+	return nil
+}
 
+// postChat sends a chat completions request and parses the response
+func (c *Client) postChat(ctx context.Context, reqBody ChatRequest) (*ChatResponse, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
@@ -211,19 +936,39 @@ func (c *Client) sendRequest() (*ChatResponse, error) {
 		fmt.Printf("[debug] Sending %d tools, %d messages\n", len(reqBody.Tools), len(reqBody.Messages))
 	}
 
-	url := strings.TrimSuffix(c.config.BaseURL, "/") + "/chat/completions"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	// An identical request was answered before; reuse the response
+	var cacheKey string
+	if c.cache != nil {
+		cacheKey = responseCacheKey(jsonBody)
+		if cached, ok := c.cache.get(cacheKey); ok {
+			var chatResp ChatResponse
+			if err := json.Unmarshal(cached, &chatResp); err == nil {
+				if debugMode {
+					fmt.Println("[debug] Using cached response")
+				}
+				return &chatResp, nil
+			}
+		}
+	}
+
+	if err := c.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	url := c.chatURL()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if c.config.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-	}
+	c.authorize(req)
 
 	resp, err := c.http.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
@@ -238,26 +983,335 @@ func (c *Client) sendRequest() (*ChatResponse, error) {
 
 	// Check status code first (issue #3 from review)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, checkContextExceeded(newAPIError(resp.StatusCode, body))
 	}
 
 	if debugMode {
 		fmt.Printf("[debug] Raw API response: %s\n", string(body))
 	}
 
+	if err := checkJSONResponse(url, resp.Header.Get("Content-Type"), body); err != nil {
+		return nil, err
+	}
+
 	var chatResp ChatResponse
 	if err := json.Unmarshal(body, &chatResp); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %v\nBody: %s", err, string(body))
 	}
 
 	if chatResp.Error != nil {
-		return nil, fmt.Errorf("API error: %s", chatResp.Error.Message)
+		return nil, checkContextExceeded(&APIError{Type: chatResp.Error.Type, Message: chatResp.Error.Message})
+	}
+
+	if c.cache != nil {
+		if err := c.cache.put(cacheKey, body); err != nil {
+			PrintError(fmt.Sprintf("Could not save response cache: %v", err))
+		}
 	}
 
 	return &chatResp, nil
 }
 
+// Default api-version for Azure OpenAI when none is configured
+const defaultAzureAPIVersion = "2024-06-01"
+
+// chatURL returns the chat completions endpoint. Azure addresses a
+// deployment and requires an api-version query parameter.
+func (c *Client) chatURL() string {
+	base := strings.TrimSuffix(c.config.BaseURL, "/")
+	if c.config.Provider != "azure" {
+		return base + "/chat/completions"
+	}
+
+	deployment := c.config.Deployment
+	if deployment == "" {
+		deployment = c.config.Model
+	}
+	apiVersion := c.config.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+	base = strings.TrimSuffix(base, "/openai")
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		base, neturl.PathEscape(deployment), neturl.QueryEscape(apiVersion))
+}
+
+// authorize adds the API key to a request
+func (c *Client) authorize(req *http.Request) {
+	if c.config.APIKey == "" {
+		return
+	}
+	if c.config.Provider == "azure" {
+		req.Header.Set("api-key", c.config.APIKey)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+}
+
+// ListModels returns the sorted model IDs reported by the provider's /models endpoint
+func (c *Client) ListModels() ([]string, error) {
+	return c.listModels(context.Background())
+}
+
+// errModelsUnsupported is returned when the provider has no /models endpoint
+var errModelsUnsupported = errors.New("this provider does not support listing models")
+
+func (c *Client) listModels(ctx context.Context) ([]string, error) {
+	url := strings.TrimSuffix(c.config.BaseURL, "/") + "/models"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errModelsUnsupported
+	default:
+		return nil, newAPIError(resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %v", err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		if m.ID != "" {
+			models = append(models, m.ID)
+		}
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// How long Ping waits for the endpoint to answer
+const pingTimeout = 5 * time.Second
+
+// Ping checks that the endpoint is reachable and, when the provider can list
+// models, that the configured model is one of them
+func (c *Client) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	models, err := c.listModels(ctx)
+	if errors.Is(err, errModelsUnsupported) {
+		return nil // Reachable; the model can't be verified
+	}
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return err
+		}
+		return fmt.Errorf("cannot reach %s: %v", c.config.BaseURL, err)
+	}
+
+	for _, m := range models {
+		// Ollama lists "llama3.2:latest" for a model requested as "llama3.2"
+		if m == c.config.Model || m == c.config.Model+":latest" {
+			return nil
+		}
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	return fmt.Errorf("model %s is not available from %s (run `models` in the REPL to list them)", c.config.Model, c.config.BaseURL)
+}
+
+// throttle waits until the configured minimum interval between requests
+// has passed, or returns early with ctx's error when it is cancelled
+func (c *Client) throttle(ctx context.Context) error {
+	// Claim the next slot under the lock so concurrent requests queue up,
+	// but wait outside it
+	c.mu.Lock()
+	now := time.Now()
+	var wait time.Duration
+	if c.config.RequestsPerMinute > 0 && !c.lastRequest.IsZero() {
+		interval := time.Minute / time.Duration(c.config.RequestsPerMinute)
+		wait = c.lastRequest.Add(interval).Sub(now)
+	}
+	c.lastRequest = now.Add(max(wait, 0))
+	c.mu.Unlock()
+
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// SetModel switches the model used for subsequent requests, keeping the conversation
+func (c *Client) SetModel(model string) {
+	c.config.Model = model
+}
+
+// Instructions added to the system prompt for each answer style
+var answerStyles = map[string]string{
+	"concise":  "Keep answers short: a few sentences or a brief list, with file and line references. Leave out background the user didn't ask for.",
+	"detailed": "Give thorough answers: explain how the relevant pieces fit together, quote the key code with file and line references, and mention edge cases.",
+}
+
+// withStyle appends the instruction for style to a system prompt
+func withStyle(prompt, style string) string {
+	if instruction, ok := answerStyles[style]; ok {
+		return prompt + "\n\n" + instruction
+	}
+	return prompt
+}
+
+// SetStyle switches the answer style ("concise", "detailed", or "" for the
+// default), keeping the conversation
+func (c *Client) SetStyle(style string) error {
+	if _, ok := answerStyles[style]; !ok && style != "" {
+		return fmt.Errorf("unknown style %q (must be concise or detailed)", style)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config.Style = style
+	c.messages[0].Content = withStyle(c.basePrompt, style)
+	return nil
+}
+
+// SetToolChoice forces the model to call the named tool on the next request.
+// Later requests go back to letting the model choose.
+func (c *Client) SetToolChoice(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.toolChoice = name
+}
+
+// LastUsage returns the token usage summed over the requests of the last Chat call
+func (c *Client) LastUsage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
+
+// addUsage adds the token usage of one response to the last Chat call's total
+func (c *Client) addUsage(u Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage.Add(u)
+}
+
+// ToolStats returns the tools called this session, most called first
+func (c *Client) ToolStats() []ToolStat {
+	return c.stats.Summary()
+}
+
+// LastQuestion returns the message passed to the most recent Chat call, or
+// "" before the first one. It survives Reset so a question can be retried
+// in a fresh conversation.
+func (c *Client) LastQuestion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.question
+}
+
+// LastTurn returns the messages added by the last Chat call, starting with the user message
+func (c *Client) LastTurn() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.turn == 0 || c.turn >= len(c.messages) {
+		return nil
+	}
+	return append([]Message(nil), c.messages[c.turn:]...)
+}
+
+// TurnSources lists the distinct tool calls in messages that returned a
+// result, formatted as "name args". Failed calls and writes are skipped
+// since they didn't inform the answer.
+func TurnSources(messages []Message) []string {
+	failed := make(map[string]bool)
+	for _, msg := range messages {
+		if result, ok := parseToolResult(msg.Content); msg.Role == "tool" && ok && result.Err != nil {
+			failed[msg.ToolCallID] = true
+		}
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			if failed[tc.ID] || writeTools[tc.Function.Name] {
+				continue
+			}
+			source := tc.Function.Name + " " + FormatToolCall(tc.Function.Name, tc.Function.Arguments)
+			if !seen[source] {
+				seen[source] = true
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources
+}
+
+// ExportMarkdown writes the conversation as a markdown transcript: each user
+// question is a heading, followed by the tool calls made (in a collapsible
+// block) and the assistant's answer
+func (c *Client) ExportMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# CodeQuery Conversation\n\n")
+
+	// An answer continued after the token limit is written as one answer
+	continued := false
+	for _, msg := range c.Messages()[1:] {
+		switch msg.Role {
+		case "user":
+			if msg.Continuation {
+				continued = true
+				continue
+			}
+			question := strings.Join(strings.Fields(msg.Content), " ")
+			fmt.Fprintf(&b, "## %s\n\n", question)
+		case "assistant":
+			if len(msg.ToolCalls) > 0 {
+				b.WriteString("<details>\n<summary>Tool calls</summary>\n\n")
+				for _, tc := range msg.ToolCalls {
+					fmt.Fprintf(&b, "    %s %s\n", tc.Function.Name, FormatToolCall(tc.Function.Name, tc.Function.Arguments))
+				}
+				b.WriteString("\n</details>\n\n")
+			}
+			if msg.Content != "" {
+				if continued {
+					text := strings.TrimSuffix(b.String(), "\n\n")
+					b.Reset()
+					b.WriteString(text)
+				}
+				b.WriteString(msg.Content + "\n\n")
+			}
+			continued = false
+		}
+	}
+
+	_, err := io.WriteString(w, formatMarkdown(b.String()))
+	return err
+}
+
 // Reset clears conversation history (keeps system message)
 func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.messages = c.messages[:1]
+	c.turn = 0
 }
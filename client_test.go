@@ -1,10 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -33,6 +44,383 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClient_SystemPrompt(t *testing.T) {
+	client := NewClient(&Config{Model: "gpt-4"})
+	if client.messages[0].Content != defaultSystemPrompt {
+		t.Error("system message should be the default prompt when none is configured")
+	}
+
+	client = NewClient(&Config{Model: "gpt-4", SystemPrompt: "Custom prompt"})
+	if client.messages[0].Content != "Custom prompt" {
+		t.Errorf("system message = %q, want %q", client.messages[0].Content, "Custom prompt")
+	}
+}
+
+func TestNewClient_SystemAppend(t *testing.T) {
+	client := NewClient(&Config{Model: "test-model", SystemAppend: "This is a Rails app."})
+
+	system := client.messages[0].Content
+	if !strings.HasPrefix(system, defaultSystemPrompt) {
+		t.Error("system prompt should start with the default prompt")
+	}
+	if !strings.HasSuffix(system, "\n\nThis is a Rails app.") {
+		t.Errorf("system prompt should end with the appended text, got %q", system[len(system)-40:])
+	}
+}
+
+func TestClient_Style(t *testing.T) {
+	client := NewClient(&Config{Model: "test-model", Style: "concise"})
+	if system := client.messages[0].Content; !strings.HasSuffix(system, answerStyles["concise"]) {
+		t.Errorf("system prompt should end with the concise instruction, got %q", system[len(system)-80:])
+	}
+
+	client.AddContext(Message{Role: "user", Content: "earlier question"})
+	if err := client.SetStyle("detailed"); err != nil {
+		t.Fatalf("SetStyle() error = %v", err)
+	}
+	system := client.messages[0].Content
+	if !strings.HasSuffix(system, answerStyles["detailed"]) || strings.Contains(system, answerStyles["concise"]) {
+		t.Errorf("system prompt should switch to the detailed instruction, got %q", system[len(system)-80:])
+	}
+	if len(client.messages) != 2 {
+		t.Errorf("SetStyle should keep the conversation, got %d messages", len(client.messages))
+	}
+
+	if err := client.SetStyle(""); err != nil || client.messages[0].Content != defaultSystemPrompt {
+		t.Errorf("SetStyle(\"\") should restore the default prompt (err = %v)", err)
+	}
+	if err := client.SetStyle("verbose"); err == nil {
+		t.Error("SetStyle(verbose) should fail")
+	}
+}
+
+func TestClient_Chat_ContextExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "This model's maximum context length is 128000 tokens. However, your messages resulted in 130512 tokens.", "type": "invalid_request_error", "code": "context_length_exceeded"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	_, err := client.Chat(context.Background(), "one more question", nil)
+	if !errors.Is(err, ErrContextExceeded) {
+		t.Fatalf("Chat() error = %v, want ErrContextExceeded", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Chat() error should still carry the APIError, got %v", err)
+	}
+
+	// Other request errors aren't mistaken for it
+	if err := checkContextExceeded(&APIError{StatusCode: 400, Message: "invalid model"}); errors.Is(err, ErrContextExceeded) {
+		t.Errorf("checkContextExceeded(invalid model) = %v", err)
+	}
+}
+
+func TestClient_LastQuestion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	if got := client.LastQuestion(); got != "" {
+		t.Errorf("LastQuestion() before any Chat = %q, want empty", got)
+	}
+
+	client.AddContext(Message{Role: "user", Content: "piped input"})
+	client.Chat(context.Background(), "first question", nil)
+	client.Chat(context.Background(), "second question", nil)
+	if got := client.LastQuestion(); got != "second question" {
+		t.Errorf("LastQuestion() = %q, want %q", got, "second question")
+	}
+
+	client.Reset()
+	if got := client.LastQuestion(); got != "second question" {
+		t.Errorf("LastQuestion() after Reset = %q, want it kept for retry", got)
+	}
+}
+
+func TestClient_Chat_AutoSummarize(t *testing.T) {
+	testFile := "test_summarize_file.txt"
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("long line of output\n", 50)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove(testFile)
+
+	requests := 0
+	var secondBody ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "cat", "arguments": "{\"path\": \"test_summarize_file.txt\"}"}}
+			]}, "finish_reason": "tool_calls"}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&secondBody)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", AutoSummarize: true, SummarizeThreshold: 100})
+	var summarized string
+	client.summarize = func(ctx context.Context, prompt, text string) (string, error) {
+		summarized = text
+		return "50 identical lines of output", nil
+	}
+	if _, err := client.Chat(context.Background(), "read it", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if !strings.HasPrefix(summarized, "long line of output") {
+		t.Errorf("summarizer got %q, want the cat output", summarized)
+	}
+	last := secondBody.Messages[len(secondBody.Messages)-1]
+	result, ok := parseToolResult(last.Content)
+	if !ok || result.Output != "50 identical lines of output" || !result.Summarized {
+		t.Errorf("tool message = %q, want the summary marked as summarized", last.Content)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2 (the injected summarizer makes none)", requests)
+	}
+}
+
+func TestClient_Chat_LabelToolResults(t *testing.T) {
+	testFile := "test_label_file.txt"
+	if err := os.WriteFile(testFile, []byte("labelled content\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove(testFile)
+
+	for _, label := range []bool{false, true} {
+		requests := 0
+		var secondBody ChatRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Content-Type", "application/json")
+			if requests == 1 {
+				w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+					{"id": "call_1", "type": "function", "function": {"name": "cat", "arguments": "{\"path\": \"test_label_file.txt\"}"}}
+				]}, "finish_reason": "tool_calls"}]}`))
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&secondBody)
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+		}))
+
+		client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", LabelToolResults: label})
+		_, err := client.Chat(context.Background(), "read it", nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+
+		last := secondBody.Messages[len(secondBody.Messages)-1]
+		header := "[result of cat test_label_file.txt]\n"
+		if got := strings.HasPrefix(last.Content, header); got != label {
+			t.Errorf("LabelToolResults=%v: tool message = %q, header present = %v", label, last.Content, got)
+		}
+		if result, ok := parseToolResult(last.Content); !ok || result.Output != "labelled content\n" {
+			t.Errorf("LabelToolResults=%v: parseToolResult(%q) = %+v, %v", label, last.Content, result, ok)
+		}
+	}
+}
+
+func TestClient_Chat_FinishReasonLength(t *testing.T) {
+	for _, autoContinue := range []bool{true, false} {
+		var bodies []ChatRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body ChatRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+			w.Header().Set("Content-Type", "application/json")
+			if len(bodies) == 1 {
+				w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "The client retries three ti"}, "finish_reason": "length"}]}`))
+				return
+			}
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "mes before giving up."}, "finish_reason": "stop"}]}`))
+		}))
+
+		client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", AutoContinue: autoContinue})
+		answer, err := client.Chat(context.Background(), "How does retrying work?", nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+
+		if !autoContinue {
+			if want := "The client retries three ti" + lengthTruncationNotice; answer != want || len(bodies) != 1 {
+				t.Errorf("Chat() without auto_continue = %q after %d requests, want %q after 1", answer, len(bodies), want)
+			}
+			continue
+		}
+		if want := "The client retries three times before giving up."; answer != want {
+			t.Errorf("Chat() with auto_continue = %q, want %q", answer, want)
+		}
+		if len(bodies) != 2 {
+			t.Fatalf("requests = %d, want 2", len(bodies))
+		}
+		last := bodies[1].Messages[len(bodies[1].Messages)-1]
+		if last.Role != "user" || last.Content != continuePrompt {
+			t.Errorf("continuation request ends with %+v, want the continue prompt", last)
+		}
+
+		// The nudge is neither a question nor a separate answer
+		questions := 0
+		for _, msg := range client.Messages() {
+			if msg.isQuestion() {
+				questions++
+			}
+		}
+		if questions != 1 {
+			t.Errorf("history has %d questions, want 1", questions)
+		}
+		var export bytes.Buffer
+		if err := client.ExportMarkdown(&export); err != nil {
+			t.Fatalf("ExportMarkdown() error = %v", err)
+		}
+		if strings.Contains(export.String(), continuePrompt) || !strings.Contains(export.String(), "The client retries three times before giving up.") {
+			t.Errorf("ExportMarkdown() = %q, want one joined answer without the continue prompt", export.String())
+		}
+		if transcript := compactTranscript(client.Messages()); strings.Contains(transcript, continuePrompt) {
+			t.Errorf("compactTranscript() includes the continue prompt:\n%s", transcript)
+		}
+	}
+}
+
+func TestClient_Chat_FinishReasonLength_Limit(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "more "}, "finish_reason": "length"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", AutoContinue: true})
+	answer, err := client.Chat(context.Background(), "Explain everything", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if requests != maxContinuations+1 {
+		t.Errorf("requests = %d, want %d", requests, maxContinuations+1)
+	}
+	if want := strings.Repeat("more ", maxContinuations+1) + lengthTruncationNotice; answer != want {
+		t.Errorf("Chat() = %q, want %q", answer, want)
+	}
+}
+
+func TestClient_ResetConcurrentWithReads(t *testing.T) {
+	client := NewClient(&Config{Model: "test-model"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client.AddContext(Message{Role: "user", Content: "context"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client.Reset()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if msgs := client.Messages(); len(msgs) == 0 || msgs[0].Role != "system" {
+					t.Error("history should always start with the system message")
+					return
+				}
+				client.LastTurn()
+			}
+		}()
+	}
+	wg.Wait()
+
+	client.Reset()
+	if n := len(client.Messages()); n != 1 {
+		t.Errorf("expected only the system message after Reset, got %d messages", n)
+	}
+}
+
+// roundTripFunc lets a function stand in for the HTTP transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClient_ResponseCache(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "responses.json")
+	requests := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"choices": [{"message": {"role": "assistant", "content": "In config.go"}, "finish_reason": "stop"}]}`)),
+		}, nil
+	})
+
+	cfg := &Config{BaseURL: "https://api.example.com/v1", Model: "test-model", CacheFile: cacheFile}
+	client := NewClient(cfg)
+	client.http.Transport = transport
+	for i := 0; i < 2; i++ {
+		response, err := client.Chat(context.Background(), "Where is config loaded?", nil)
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		if response != "In config.go" {
+			t.Errorf("Chat() = %q, want %q", response, "In config.go")
+		}
+		client.Reset()
+	}
+	if requests != 1 {
+		t.Errorf("API requests = %d, want 1 for two identical requests", requests)
+	}
+
+	// A new session reads the cache file
+	client = NewClient(cfg)
+	client.http.Transport = transport
+	if _, err := client.Chat(context.Background(), "Where is config loaded?", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("API requests = %d, want the persisted response to be reused", requests)
+	}
+
+	// A different model is a different request
+	client.Reset()
+	client.SetModel("other-model")
+	if _, err := client.Chat(context.Background(), "Where is config loaded?", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("API requests = %d, want 2 after switching models", requests)
+	}
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	rc := newResponseCache("", time.Minute)
+	rc.put("key", []byte(`{}`))
+	if _, ok := rc.get("key"); !ok {
+		t.Error("fresh entry should be returned")
+	}
+
+	rc.entries["key"] = responseCacheEntry{Response: []byte(`{}`), Stored: time.Now().Add(-2 * time.Minute)}
+	if _, ok := rc.get("key"); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
+
 func TestClient_Reset(t *testing.T) {
 	cfg := &Config{
 		APIKey:  "test-key",
@@ -60,6 +448,15 @@ func TestClient_Reset(t *testing.T) {
 	}
 }
 
+func TestClient_AddContext(t *testing.T) {
+	client := NewClient(&Config{Model: "test-model"})
+	client.AddContext(Message{Role: "user", Content: "data"})
+
+	if len(client.messages) != 2 || client.messages[1].Role != "user" {
+		t.Fatalf("messages = %+v, want system prompt then context", client.messages)
+	}
+}
+
 func TestMessage_JSON(t *testing.T) {
 	msg := Message{
 		Role:    "assistant",
@@ -84,6 +481,86 @@ func TestMessage_JSON(t *testing.T) {
 	}
 }
 
+func TestChatRequest_ReasoningEffort(t *testing.T) {
+	data, err := json.Marshal(ChatRequest{Model: "o3-mini", ReasoningEffort: "high"})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	if !strings.Contains(string(data), `"reasoning_effort":"high"`) {
+		t.Errorf("request = %s, want reasoning_effort", data)
+	}
+
+	data, _ = json.Marshal(ChatRequest{Model: "gpt-4o"})
+	if strings.Contains(string(data), "reasoning_effort") {
+		t.Errorf("request = %s, want reasoning_effort omitted when empty", data)
+	}
+}
+
+func TestClient_SendRequest_Seed(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	for _, seed := range []int{42, 0} {
+		client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", Seed: seed})
+		if _, err := client.Chat(context.Background(), "hello", nil); err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+	}
+
+	if got := bodies[0]["seed"]; got != float64(42) {
+		t.Errorf("seed = %v, want 42 when configured", got)
+	}
+	if _, ok := bodies[1]["seed"]; ok {
+		t.Errorf("request = %v, want seed omitted when not configured", bodies[1])
+	}
+}
+
+func TestChatRequest_ExtraParams(t *testing.T) {
+	req := ChatRequest{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "hello"}},
+		Seed:     7,
+		ExtraParams: map[string]interface{}{
+			"top_p":    0.9,
+			"model":    "other-model",
+			"seed":     1,
+			"messages": []interface{}{},
+			"stream":   true,
+		},
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	if body["top_p"] != 0.9 {
+		t.Errorf("top_p = %v, want 0.9 from extra_params", body["top_p"])
+	}
+	if body["model"] != "test-model" || body["seed"] != float64(7) || len(body["messages"].([]interface{})) != 1 {
+		t.Errorf("request = %s, want extra_params not to override core fields", data)
+	}
+	if _, ok := body["stream"]; ok {
+		t.Errorf("request = %s, want stream left out", data)
+	}
+
+	// Without extra params the body is unchanged
+	plain, _ := json.Marshal(ChatRequest{Model: "test-model"})
+	if string(plain) != `{"model":"test-model","messages":null}` {
+		t.Errorf("request = %s", plain)
+	}
+}
+
 func TestMessage_WithToolCalls(t *testing.T) {
 	msg := Message{
 		Role: "assistant",
@@ -269,7 +746,7 @@ func TestChatResponse_WithError(t *testing.T) {
 
 func TestToolDefinitions_Structure(t *testing.T) {
 	// Verify all tools are defined
-	expectedTools := []string{"ls", "cat", "head", "grep", "find", "tree", "write_markdown"}
+	expectedTools := []string{"ls", "cat", "head", "tail", "read_chunk", "grep", "grep_context", "find", "tree", "du", "hexdump", "hash", "read_symbol", "depends_on", "project_info", "git_diff", "git_show", "which", "list_tools", "write_markdown", "edit_markdown"}
 
 	if len(ToolDefinitions) != len(expectedTools) {
 		t.Errorf("ToolDefinitions length = %d, want %d", len(ToolDefinitions), len(expectedTools))
@@ -347,3 +824,1009 @@ func TestClient_SendRequest_MockServer(t *testing.T) {
 		t.Errorf("client.config.BaseURL = %q, want %q", client.config.BaseURL, server.URL)
 	}
 }
+
+// newToolCall builds a function tool call for tests
+func newToolCall(id, name, args string) ToolCall {
+	tc := ToolCall{ID: id, Type: "function"}
+	tc.Function.Name = name
+	tc.Function.Arguments = args
+	return tc
+}
+
+func TestTurnSources(t *testing.T) {
+	turn := []Message{
+		{Role: "user", Content: "Where is config loaded?"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			newToolCall("call_1", "grep", `{"pattern": "LoadConfig", "path": "."}`),
+			newToolCall("call_2", "cat", `{"path": "missing.go"}`),
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: `{"output":"config.go:17:func LoadConfig()"}`},
+		{Role: "tool", ToolCallID: "call_2", Content: `{"output":"","error":"no such file"}`},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			newToolCall("call_3", "cat", `{"path": "config.go"}`),
+			newToolCall("call_4", "grep", `{"pattern": "LoadConfig", "path": "."}`),
+		}},
+		{Role: "tool", ToolCallID: "call_3", Content: `{"output":"package main"}`},
+		{Role: "tool", ToolCallID: "call_4", Content: `{"output":"config.go:17:func LoadConfig()"}`},
+		{Role: "assistant", Content: "In config.go"},
+	}
+
+	sources := TurnSources(turn)
+
+	expected := []string{`grep -r "LoadConfig" .`, "cat config.go"}
+	if len(sources) != len(expected) {
+		t.Fatalf("TurnSources() = %v, want %v", sources, expected)
+	}
+	for i := range expected {
+		if sources[i] != expected[i] {
+			t.Errorf("TurnSources()[%d] = %q, want %q", i, sources[i], expected[i])
+		}
+	}
+}
+
+func TestClient_LastTurn(t *testing.T) {
+	client := NewClient(&Config{Model: "gpt-4"})
+	if turn := client.LastTurn(); turn != nil {
+		t.Errorf("LastTurn() before any chat = %v, want nil", turn)
+	}
+
+	client.turn = len(client.messages)
+	client.messages = append(client.messages,
+		Message{Role: "user", Content: "hello"},
+		Message{Role: "assistant", Content: "hi"},
+	)
+
+	turn := client.LastTurn()
+	if len(turn) != 2 || turn[0].Role != "user" {
+		t.Errorf("LastTurn() = %v, want the user and assistant messages", turn)
+	}
+
+	client.Reset()
+	if turn := client.LastTurn(); turn != nil {
+		t.Errorf("LastTurn() after reset = %v, want nil", turn)
+	}
+}
+
+func TestClient_SetToolChoice(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+	client.SetToolChoice("tree")
+
+	if _, err := client.Chat(context.Background(), "first", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if _, err := client.Chat(context.Background(), "second", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	choice, ok := bodies[0]["tool_choice"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("first request tool_choice = %v, want forced function", bodies[0]["tool_choice"])
+	}
+	if choice["type"] != "function" {
+		t.Errorf("tool_choice.type = %v, want function", choice["type"])
+	}
+	if fn := choice["function"].(map[string]interface{}); fn["name"] != "tree" {
+		t.Errorf("tool_choice.function.name = %v, want tree", fn["name"])
+	}
+
+	if _, ok := bodies[1]["tool_choice"]; ok {
+		t.Errorf("second request should fall back to auto, got tool_choice = %v", bodies[1]["tool_choice"])
+	}
+}
+
+func TestClient_ExportMarkdown(t *testing.T) {
+	client := NewClient(&Config{Model: "gpt-4"})
+	client.messages = append(client.messages,
+		Message{Role: "user", Content: "Where is config loaded?"},
+		Message{Role: "assistant", ToolCalls: []ToolCall{
+			newToolCall("call_1", "cat", `{"path": "config.go"}`),
+		}},
+		Message{Role: "tool", ToolCallID: "call_1", Content: "package main"},
+		Message{Role: "assistant", Content: "In config.go."},
+		Message{Role: "user", Content: "And the\nmodel default?"},
+		Message{Role: "assistant", Content: "It is gpt-4o.   "},
+	)
+
+	var buf strings.Builder
+	if err := client.ExportMarkdown(&buf); err != nil {
+		t.Fatalf("ExportMarkdown() error = %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "helpful assistant") {
+		t.Error("transcript should not include the system prompt")
+	}
+	if strings.Contains(out, "package main") {
+		t.Error("transcript should not include raw tool output")
+	}
+
+	order := []string{
+		"## Where is config loaded?",
+		"    cat config.go",
+		"In config.go.",
+		"## And the model default?",
+		"It is gpt-4o.\n",
+	}
+	pos := 0
+	for _, want := range order {
+		idx := strings.Index(out[pos:], want)
+		if idx == -1 {
+			t.Fatalf("transcript missing %q after offset %d:\n%s", want, pos, out)
+		}
+		pos += idx + len(want)
+	}
+}
+
+func TestClient_Throttle(t *testing.T) {
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	// 600 requests per minute is one request every 100ms
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", RequestsPerMinute: 600})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Chat(context.Background(), "hello", nil); err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+	}
+
+	if len(times) != 2 {
+		t.Fatalf("server received %d requests, want 2", len(times))
+	}
+	if gap := times[1].Sub(times[0]); gap < 90*time.Millisecond {
+		t.Errorf("requests were %v apart, want at least 100ms", gap)
+	}
+}
+
+func TestClient_Throttle_Cancel(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	// One request a minute: the second would wait for most of a minute
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", RequestsPerMinute: 1})
+	if _, err := client.Chat(context.Background(), "hello", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := client.Chat(ctx, "hello again", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Chat() error = %v, want the context's error", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("cancelled throttle wait took %v", elapsed)
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, want 1", requests)
+	}
+}
+
+func TestClient_StateConcurrentWithChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}}`))
+	}))
+	defer server.Close()
+
+	// A high rate limit still exercises the throttle's bookkeeping
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", RequestsPerMinute: 60000})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := client.Chat(context.Background(), "hello", nil); err != nil {
+					t.Errorf("Chat() error = %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client.SetToolChoice("cat")
+				client.LastUsage()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := client.LastUsage().TotalTokens; got%15 != 0 || got == 0 {
+		t.Errorf("LastUsage().TotalTokens = %d, want a multiple of one response's usage", got)
+	}
+}
+
+func TestClient_SendRequest_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold the request open until the client gives up
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.sendRequest(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("sendRequest() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("sendRequest() took %v to return after cancel", elapsed)
+	}
+}
+
+func TestClient_Chat_MaxToolIterations(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Still looking", "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "list_tools", "arguments": "{}"}}
+		]}, "finish_reason": "tool_calls"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", MaxToolIterations: 3})
+	tools := 0
+	response, err := client.Chat(context.Background(), "loop forever", func(name, argsJSON, result string) {
+		tools++
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "exceeded maximum tool iterations") {
+		t.Fatalf("Chat() error = %v, want exceeded maximum tool iterations", err)
+	}
+	if response != "Still looking" {
+		t.Errorf("Chat() response = %q, want partial content", response)
+	}
+	if tools != 3 {
+		t.Errorf("tool calls = %d, want 3", tools)
+	}
+	if requests != 4 {
+		t.Errorf("requests = %d, want 4", requests)
+	}
+
+	// History must not end with unanswered tool calls
+	last := client.messages[len(client.messages)-1]
+	if last.Role != "tool" {
+		t.Errorf("last message role = %q, want tool", last.Role)
+	}
+}
+
+func TestClient_Chat_DuplicateToolCalls(t *testing.T) {
+	counts := countToolRuns(t)
+	requests := 0
+	var secondBody ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "list_tools", "arguments": "{}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "list_tools", "arguments": "{}"}}
+			]}, "finish_reason": "tool_calls"}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&secondBody)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	if _, err := client.Chat(context.Background(), "what tools?", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if counts["list_tools"] != 1 {
+		t.Errorf("list_tools ran %d times, want 1", counts["list_tools"])
+	}
+
+	var toolMsgs []Message
+	for _, msg := range secondBody.Messages {
+		if msg.Role == "tool" {
+			toolMsgs = append(toolMsgs, msg)
+		}
+	}
+	if len(toolMsgs) != 2 || toolMsgs[0].ToolCallID != "call_1" || toolMsgs[1].ToolCallID != "call_2" {
+		t.Fatalf("tool messages = %+v, want one per call ID", toolMsgs)
+	}
+	if toolMsgs[0].Content != toolMsgs[1].Content {
+		t.Error("duplicate call should reuse the first result")
+	}
+}
+
+func TestParseLeakedToolCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		ok       bool
+		toolName string
+		args     string
+	}{
+		{"arguments object", `{"name": "cat", "arguments": {"path": "main.go"}}`, true, "cat", `{"path": "main.go"}`},
+		{"arguments string", `{"name": "cat", "arguments": "{\"path\": \"main.go\"}"}`, true, "cat", `{"path": "main.go"}`},
+		{"parameters key", `{"name": "ls", "parameters": {"path": "src"}}`, true, "ls", `{"path": "src"}`},
+		{"function wrapper", `{"function": {"name": "tree", "arguments": {}}}`, true, "tree", `{}`},
+		{"code fence", "```json\n{\"name\": \"list_tools\"}\n```", true, "list_tools", `{}`},
+		{"unknown tool", `{"name": "rm", "arguments": {"path": "/"}}`, false, "", ""},
+		{"unknown parameter", `{"name": "cat", "arguments": {"file": "main.go"}}`, false, "", ""},
+		{"prose", `The config is loaded in {"name": "cat"}`, false, "", ""},
+		{"plain answer", "Authentication is handled in auth.go.", false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, ok := parseLeakedToolCall(tt.content)
+			if ok != tt.ok {
+				t.Fatalf("parseLeakedToolCall(%q) ok = %v, want %v", tt.content, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if tc.Function.Name != tt.toolName || tc.Function.Arguments != tt.args {
+				t.Errorf("parseLeakedToolCall() = %s %s, want %s %s", tc.Function.Name, tc.Function.Arguments, tt.toolName, tt.args)
+			}
+		})
+	}
+}
+
+func TestClient_Chat_LenientLeakedToolCall(t *testing.T) {
+	counts := countToolRuns(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"name\": \"list_tools\", \"arguments\": {}}"}, "finish_reason": "stop"}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "There are several tools."}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", Lenient: true})
+	response, err := client.Chat(context.Background(), "what tools?", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if counts["list_tools"] != 1 {
+		t.Errorf("list_tools ran %d times, want 1", counts["list_tools"])
+	}
+	if response != "There are several tools." {
+		t.Errorf("Chat() = %q, want the answer after the tool ran", response)
+	}
+
+	// Without -lenient the JSON is returned as the answer
+	requests = 0
+	strict := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	response, _ = strict.Chat(context.Background(), "what tools?", nil)
+	if !strings.Contains(response, "list_tools") || counts["list_tools"] != 1 {
+		t.Errorf("strict Chat() = %q, ran tool %d times; want raw JSON and no extra run", response, counts["list_tools"])
+	}
+}
+
+func TestClient_Chat_InvalidToolArguments(t *testing.T) {
+	requests := 0
+	var secondBody ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "head", "arguments": "{path: main.go"}}
+			]}, "finish_reason": "tool_calls"}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&secondBody)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	if _, err := client.Chat(context.Background(), "show main.go", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	last := secondBody.Messages[len(secondBody.Messages)-1]
+	if last.Role != "tool" || last.ToolCallID != "call_1" {
+		t.Fatalf("last message = %+v, want the tool result for call_1", last)
+	}
+	result, ok := parseToolResult(last.Content)
+	if !ok || result.Err == nil {
+		t.Fatalf("tool message = %q, want an error result", last.Content)
+	}
+	for _, want := range []string{"invalid arguments", "Call head again", "- path (string, required)", "- lines (integer)"} {
+		if !strings.Contains(result.Err.Error(), want) {
+			t.Errorf("corrective message = %q, want it to contain %q", result.Err, want)
+		}
+	}
+}
+
+func TestEncodeToolResult_RoundTrip(t *testing.T) {
+	binary := "header\x00\x01\x02body\xff"
+	if !hasNonPrintable(binary) {
+		t.Fatal("hasNonPrintable() = false for NUL bytes, want true")
+	}
+	if hasNonPrintable("plain text\n\twith tabs") {
+		t.Error("hasNonPrintable() = true for plain text, want false")
+	}
+
+	encoded := encodeToolResult(binary)
+	if !strings.HasPrefix(encoded, base64ResultStart) || strings.ContainsRune(encoded, 0) {
+		t.Errorf("encodeToolResult() = %q, want marker-wrapped base64", encoded)
+	}
+	decoded, err := decodeToolResult(encoded)
+	if err != nil {
+		t.Fatalf("decodeToolResult() error = %v", err)
+	}
+	if decoded != binary {
+		t.Errorf("round trip = %q, want %q", decoded, binary)
+	}
+}
+
+func TestClient_Chat_EncodeBinaryResults(t *testing.T) {
+	if err := os.WriteFile("test_binary_result.txt", []byte("abc\x00def"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove("test_binary_result.txt")
+
+	requests := 0
+	var secondBody ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "cat", "arguments": "{\"path\": \"test_binary_result.txt\"}"}}
+			]}, "finish_reason": "tool_calls"}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&secondBody)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model", EncodeBinaryResults: true})
+	if !strings.Contains(client.messages[0].Content, base64ResultStart) {
+		t.Error("system prompt should explain the base64 markers")
+	}
+	if _, err := client.Chat(context.Background(), "read it", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	last := secondBody.Messages[len(secondBody.Messages)-1]
+	result, _ := parseToolResult(last.Content)
+	decoded, err := decodeToolResult(result.Output)
+	if err != nil {
+		t.Fatalf("decodeToolResult() error = %v", err)
+	}
+	if result.Output == decoded || decoded != "abc\x00def" {
+		t.Errorf("tool message = %q, want base64 of the file contents", last.Content)
+	}
+}
+
+func TestClient_SendRequest_APIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantType   string
+		wantMsg    string
+		wantSubstr string
+	}{
+		{
+			name:       "unauthorized",
+			status:     http.StatusUnauthorized,
+			body:       `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`,
+			wantType:   "invalid_request_error",
+			wantMsg:    "Incorrect API key provided",
+			wantSubstr: "status 401",
+		},
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			body:       `{"error": {"message": "Rate limit reached", "type": "rate_limit_exceeded"}}`,
+			wantType:   "rate_limit_exceeded",
+			wantMsg:    "Rate limit reached",
+			wantSubstr: "status 429",
+		},
+		{
+			name:       "plain text body",
+			status:     http.StatusBadGateway,
+			body:       "upstream unavailable",
+			wantMsg:    "upstream unavailable",
+			wantSubstr: "status 502",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+			_, err := client.sendRequest(context.Background())
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("sendRequest() error = %T %v, want *APIError", err, err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if apiErr.Type != tt.wantType {
+				t.Errorf("Type = %q, want %q", apiErr.Type, tt.wantType)
+			}
+			if apiErr.Message != tt.wantMsg {
+				t.Errorf("Message = %q, want %q", apiErr.Message, tt.wantMsg)
+			}
+			if !strings.Contains(err.Error(), tt.wantSubstr) {
+				t.Errorf("Error() = %q, want it to contain %q", err.Error(), tt.wantSubstr)
+			}
+		})
+	}
+}
+
+func TestClient_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/v1/models" {
+			t.Errorf("request = %s %s, want GET /v1/models", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected Authorization: Bearer test-key")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [
+			{"id": "gpt-4o-mini", "object": "model"},
+			{"id": "gpt-4o", "object": "model"},
+			{"id": "o1", "object": "model"}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL + "/v1/", Model: "gpt-4o"})
+
+	models, err := client.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	expected := []string{"gpt-4o", "gpt-4o-mini", "o1"}
+	if strings.Join(models, ",") != strings.Join(expected, ",") {
+		t.Errorf("ListModels() = %v, want %v", models, expected)
+	}
+}
+
+func TestClient_ListModels_Unsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "gpt-4o"})
+
+	_, err := client.ListModels()
+	if err == nil || !strings.Contains(err.Error(), "does not support listing models") {
+		t.Errorf("ListModels() error = %v, want friendly unsupported message", err)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("request path = %s, want /v1/models", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"id": "llama3.2:latest"}, {"id": "qwen2.5-coder:7b"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		model   string
+		wantErr string
+	}{
+		{"llama3.2", ""},
+		{"qwen2.5-coder:7b", ""},
+		{"mistral", "not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			client := NewClient(&Config{BaseURL: server.URL + "/v1", Model: tt.model})
+			err := client.Ping()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Ping() error = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Ping() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_Ping_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := NewClient(&Config{BaseURL: url, Model: "llama3.2"})
+	if err := client.Ping(); err == nil || !strings.Contains(err.Error(), "cannot reach") {
+		t.Errorf("Ping() error = %v, want cannot reach", err)
+	}
+}
+
+func TestClient_Ping_ModelsUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "gpt-4o"})
+	if err := client.Ping(); err != nil {
+		t.Errorf("Ping() error = %v, want nil when the endpoint answers", err)
+	}
+}
+
+func TestClient_SetModel(t *testing.T) {
+	cfg := &Config{Model: "gpt-4o-mini"}
+	client := NewClient(cfg)
+	client.messages = append(client.messages,
+		Message{Role: "user", Content: "hello"},
+		Message{Role: "assistant", Content: "hi"},
+	)
+
+	client.SetModel("gpt-4o")
+
+	if cfg.Model != "gpt-4o" {
+		t.Errorf("config.Model = %q, want %q", cfg.Model, "gpt-4o")
+	}
+	if len(client.messages) != 3 {
+		t.Errorf("messages length = %d, want 3 (history preserved)", len(client.messages))
+	}
+}
+
+func TestClient_AzureDeploymentURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-gpt4o/chat/completions" {
+			t.Errorf("path = %q, want deployment chat completions path", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-02-01" {
+			t.Errorf("api-version = %q, want %q", got, "2024-02-01")
+		}
+		if got := r.Header.Get("api-key"); got != "azure-key" {
+			t.Errorf("api-key header = %q, want %q", got, "azure-key")
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization header = %q, want none for Azure", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{
+		APIKey:     "azure-key",
+		BaseURL:    server.URL + "/openai/",
+		Model:      "gpt-4o",
+		Provider:   "azure",
+		Deployment: "my-gpt4o",
+		APIVersion: "2024-02-01",
+	})
+
+	if _, err := client.Chat(context.Background(), "hello", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+}
+
+func TestClient_ChatURL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"openai", Config{BaseURL: "https://api.openai.com/v1/"}, "https://api.openai.com/v1/chat/completions"},
+		{"azure defaults", Config{BaseURL: "https://res.openai.azure.com", Provider: "azure", Model: "gpt-4o"},
+			"https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=" + defaultAzureAPIVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(&tt.cfg)
+			if got := client.chatURL(); got != tt.want {
+				t.Errorf("chatURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// conversationFixture returns a client with n questions, each answered after one tool call
+func conversationFixture(n int) *Client {
+	client := NewClient(&Config{Model: "test-model"})
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("call_%d", i)
+		client.appendMessage(Message{Role: "user", Content: fmt.Sprintf("question %d", i)})
+		tc := ToolCall{ID: id, Type: "function"}
+		tc.Function.Name, tc.Function.Arguments = "cat", `{"path": "main.go"}`
+		client.appendMessage(Message{Role: "assistant", ToolCalls: []ToolCall{tc}})
+		client.appendMessage(Message{Role: "tool", ToolCallID: id, Content: ToolResult{Output: "package main"}.JSON()})
+		client.appendMessage(Message{Role: "assistant", Content: fmt.Sprintf("answer %d", i)})
+	}
+	return client
+}
+
+func TestClient_Compact(t *testing.T) {
+	client := conversationFixture(4)
+	before := client.Messages()
+
+	var transcript string
+	client.summarize = func(ctx context.Context, prompt, text string) (string, error) {
+		transcript = text
+		return "Questions 1 and 2 were about main.go.", nil
+	}
+	if err := client.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	after := client.Messages()
+	if len(after) >= len(before) {
+		t.Fatalf("Compact() left %d messages, want fewer than %d", len(after), len(before))
+	}
+	if !reflect.DeepEqual(after[0], before[0]) {
+		t.Errorf("system message changed: %q", after[0].Content)
+	}
+	if after[1].Role != "system" || !strings.Contains(after[1].Content, "Questions 1 and 2 were about main.go.") {
+		t.Errorf("messages[1] = %+v, want the summary as a system message", after[1])
+	}
+	// The last two questions are kept as they were
+	if !reflect.DeepEqual(after[2:], before[len(before)-8:]) {
+		t.Errorf("recent turns = %+v, want the last two questions unchanged", after[2:])
+	}
+	for _, want := range []string{"User: question 1", "Tool call: cat main.go", "Tool result: package main", "Assistant: answer 2"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+	if strings.Contains(transcript, "question 3") {
+		t.Errorf("transcript should only cover the older questions:\n%s", transcript)
+	}
+}
+
+func TestClient_Compact_NothingToSummarize(t *testing.T) {
+	client := conversationFixture(2)
+	client.summarize = func(ctx context.Context, prompt, text string) (string, error) {
+		t.Error("summarizer should not be called")
+		return "", nil
+	}
+	if err := client.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if got := len(client.Messages()); got != 9 {
+		t.Errorf("Compact() left %d messages, want all 9", got)
+	}
+}
+
+func TestClient_Chat_AutoCompact(t *testing.T) {
+	var body ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := conversationFixture(3)
+	client.config = &Config{BaseURL: server.URL, Model: "test-model", AutoCompactAfter: 10}
+	client.summarize = func(ctx context.Context, prompt, text string) (string, error) {
+		return "earlier summary", nil
+	}
+	if _, err := client.Chat(context.Background(), "question 4", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	// System prompt, summary, questions 2 and 3, then the new question
+	if len(body.Messages) != 11 || body.Messages[1].Content != "Summary of the earlier conversation:\n\nearlier summary" {
+		t.Errorf("request messages = %+v, want the compacted history", body.Messages)
+	}
+	if turn := client.LastTurn(); len(turn) != 2 || turn[0].Content != "question 4" {
+		t.Errorf("LastTurn() = %+v, want the new question and answer", turn)
+	}
+}
+
+func TestPinnedFile(t *testing.T) {
+	tests := []struct {
+		question, name, args string
+		want                 string
+	}{
+		{"What does config.go do?", "cat", `{"path": "config.go"}`, "config.go"},
+		{"Explain ./internal/api/server.go.", "cat", `{"path": "internal/api/server.go"}`, "internal/api/server.go"},
+		{"Is `.env.example` complete?", "cat", `{"path": ".env.example"}`, ".env.example"},
+		{"How is the server started?", "cat", `{"path": "main.go"}`, ""},
+		{"What does config.go do?", "head", `{"path": "config.go"}`, ""},
+		{"What is in the Makefile?", "cat", `{"path": "Makefile"}`, "Makefile"},
+		{"Which part is mainly tested?", "cat", `{"path": "main"}`, ""},
+	}
+	for _, tt := range tests {
+		if got := pinnedFile(tt.question, tt.name, tt.args); got != tt.want {
+			t.Errorf("pinnedFile(%q, %s %s) = %q, want %q", tt.question, tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestClient_Compact_KeepsPinned(t *testing.T) {
+	client := conversationFixture(4)
+	// Pin the result of question 1's cat; a later pin of the same file replaces it
+	client.mu.Lock()
+	client.messages[3].Pinned = "main.go"
+	client.mu.Unlock()
+	client.summarize = func(ctx context.Context, prompt, text string) (string, error) {
+		return "summary", nil
+	}
+	if err := client.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	msgs := client.Messages()
+	// System prompt, summary, the pinned call and result, then the last two questions
+	if len(msgs) != 12 {
+		t.Fatalf("Compact() left %d messages, want 12: %+v", len(msgs), msgs)
+	}
+	if msgs[2].Role != "assistant" || len(msgs[2].ToolCalls) != 1 || msgs[2].ToolCalls[0].ID != "call_1" {
+		t.Errorf("messages[2] = %+v, want the call of the pinned result", msgs[2])
+	}
+	if msgs[3].ToolCallID != "call_1" || msgs[3].Pinned != "main.go" {
+		t.Errorf("messages[3] = %+v, want the pinned result", msgs[3])
+	}
+	for _, msg := range msgs {
+		if msg.ToolCallID == "call_2" || msg.Content == "question 2" {
+			t.Errorf("unpinned older message survived: %+v", msg)
+		}
+	}
+
+	client.appendMessage(Message{Role: "tool", ToolCallID: "call_5", Pinned: "main.go"})
+	if msgs := client.Messages(); msgs[3].Pinned != "" {
+		t.Error("a newer pin of the same file should replace the older one")
+	}
+}
+
+func TestClient_Chat_NonJSONResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"html", "text/html; charset=utf-8", "<!DOCTYPE html>\n<html><body>Welcome</body></html>", "returned an HTML page instead of JSON"},
+		{"html without content type", "", "<html><body>Welcome</body></html>", "returned an HTML page instead of JSON"},
+		{"plain text", "text/plain", "OK", "returned a non-JSON response (text/plain)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+			_, err := client.Chat(context.Background(), "hello", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), "base_url") {
+				t.Errorf("Chat() error = %v, want %q with a base_url hint", err, tt.want)
+			}
+		})
+	}
+
+	// Malformed JSON is still reported as a parse error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [`))
+	}))
+	defer server.Close()
+	client := NewClient(&Config{BaseURL: server.URL, Model: "test-model"})
+	if _, err := client.Chat(context.Background(), "hello", nil); err == nil || !strings.Contains(err.Error(), "failed to parse response") {
+		t.Errorf("Chat() error = %v, want a parse error", err)
+	}
+}
+
+func TestClient_Chat_CancelRollsBack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "ls", "arguments": "{\"path\": \".\"}"}},
+			{"id": "call_2", "type": "function", "function": {"name": "ls", "arguments": "{\"path\": \"..\"}"}}
+		]}, "finish_reason": "tool_calls"}]}`))
+	}))
+	defer server.Close()
+
+	client := conversationFixture(1)
+	client.config = &Config{BaseURL: server.URL, Model: "test-model"}
+	before := client.Messages()
+
+	// Cancel after the first of two tool calls has run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := client.Chat(ctx, "list everything", func(name, argsJSON, result string) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Chat() error = %v, want context.Canceled", err)
+	}
+
+	if after := client.Messages(); !reflect.DeepEqual(after, before) {
+		t.Errorf("messages after cancel = %+v, want the history from before the question", after)
+	}
+	if client.LastTurn() != nil {
+		t.Errorf("LastTurn() = %+v, want nil after cancel", client.LastTurn())
+	}
+	if client.LastQuestion() != "list everything" {
+		t.Errorf("LastQuestion() = %q, want the cancelled question kept for retry", client.LastQuestion())
+	}
+}
+
+func TestClient_Chat_ReasoningContent(t *testing.T) {
+	response := `{"choices": [{"message": {"role": "assistant", "content": "It parses flags.", "reasoning_content": "The user asks about main.go. It calls flag.Parse."}, "finish_reason": "stop"}]}`
+
+	var parsed ChatResponse
+	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got := parsed.Choices[0].Message.Thinking(); got != "The user asks about main.go. It calls flag.Parse." {
+		t.Errorf("Thinking() = %q, want the reasoning_content", got)
+	}
+
+	var secondBody string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			data, _ := io.ReadAll(r.Body)
+			secondBody = string(data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Model: "deepseek-reasoner"})
+	answer, err := client.Chat(context.Background(), "What does main.go do?", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if answer != "It parses flags." {
+		t.Errorf("Chat() = %q, want only the content", answer)
+	}
+
+	// The thinking stays out of later requests
+	client.Chat(context.Background(), "And config.go?", nil)
+	if strings.Contains(secondBody, "reasoning_content") || strings.Contains(secondBody, "flag.Parse") {
+		t.Errorf("second request = %s, want reasoning_content left out", secondBody)
+	}
+}
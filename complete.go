@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// REPL commands offered by tab completion
+var replCommands = []string{"exit", "quit", "clear", "reset", "help", "models", "model", "style", "retry", "stats", "export", "force", "check"}
+
+// replCompleter completes REPL command names at the start of the line, tool
+// names after "force", and file paths relative to the working directory
+// everywhere else
+type replCompleter struct{}
+
+// newCompleter returns the tab completer for the REPL prompt
+func newCompleter() readline.AutoCompleter {
+	return replCompleter{}
+}
+
+// Do returns the completions for the word ending at pos as suffixes to
+// append, along with the length of the word being completed
+func (replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	start := strings.LastIndexAny(text, " \t") + 1
+	word := text[start:]
+
+	var candidates []string
+	switch {
+	case start == 0:
+		candidates = matchPrefix(replCommands, word)
+	case strings.TrimSpace(text[:start]) == "force":
+		var tools []string
+		for _, tool := range EnabledTools() {
+			if fn, ok := tool["function"].(map[string]interface{}); ok {
+				tools = append(tools, fn["name"].(string))
+			}
+		}
+		candidates = matchPrefix(tools, word)
+	default:
+		candidates = completePath(word)
+	}
+
+	suffixes := make([][]rune, len(candidates))
+	for i, c := range candidates {
+		suffixes[i] = []rune(strings.TrimPrefix(c, word))
+	}
+	return suffixes, len([]rune(word))
+}
+
+// matchPrefix returns the words that start with prefix
+func matchPrefix(words []string, prefix string) []string {
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+// completePath lists paths that start with prefix. Directories end in "/";
+// hidden and blocked entries are left out unless the prefix asks for them.
+func completePath(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := dir + name
+		if IsPathBlocked(path) {
+			continue
+		}
+		if e.IsDir() {
+			path += "/"
+		}
+		matches = append(matches, path)
+	}
+	sort.Strings(matches)
+	return matches
+}
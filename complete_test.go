@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// completions runs the REPL completer on line with the cursor at the end
+func completions(line string) ([]string, int) {
+	suffixes, length := newCompleter().Do([]rune(line), len([]rune(line)))
+	var got []string
+	for _, s := range suffixes {
+		got = append(got, string(s))
+	}
+	return got, length
+}
+
+func TestCompleter_Commands(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   []string
+		length int
+	}{
+		{"hel", []string{"p"}, 3},
+		{"mod", []string{"els", "el"}, 3},
+		{"ex", []string{"it", "port"}, 2},
+		{"force read_", []string{"chunk", "symbol"}, 5},
+		{"zzz", nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, length := completions(tt.line)
+			if !reflect.DeepEqual(got, tt.want) || length != tt.length {
+				t.Errorf("completions(%q) = %v, %d; want %v, %d", tt.line, got, length, tt.want, tt.length)
+			}
+		})
+	}
+}
+
+func TestCompleter_Paths(t *testing.T) {
+	if err := os.MkdirAll("test_complete/sub", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll("test_complete")
+	for _, name := range []string{"test_complete/alpha.go", "test_complete/alpine.md", "test_complete/.env", "test_complete/.hidden"} {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"what does test_complete/al", []string{"pha.go", "pine.md"}},
+		{"export test_complete/s", []string{"ub/"}},
+		{"check test_complete/.h", []string{"idden"}},
+		{"cat test_complete/.e", nil}, // blocked
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got, _ := completions(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completions(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
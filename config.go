@@ -1,35 +1,175 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
+// Directory holding per-repo settings, discovered in the current directory
+const projectDir = ".codequery"
+
 type Config struct {
-	APIKey  string `json:"api_key"`
-	BaseURL string `json:"base_url"`
-	Model   string `json:"model"`
+	APIKey        string `json:"api_key"`
+	APIKeyCommand string `json:"api_key_command,omitempty"` // Shell command that prints the API key
+	BaseURL       string `json:"base_url"`
+	Model         string `json:"model"`
+	Provider      string `json:"provider,omitempty"`    // Detected from BaseURL when empty
+	Deployment    string `json:"deployment,omitempty"`  // Azure deployment name (default: Model)
+	APIVersion    string `json:"api_version,omitempty"` // Azure api-version query parameter
+	SystemPrompt  string `json:"system_prompt,omitempty"`
+	SystemAppend  string `json:"system_append,omitempty"` // Added to the end of the system prompt
+	AppName       string `json:"app_name,omitempty"`      // Name in the welcome banner (default: CodeQuery)
+	Banner        string `json:"banner,omitempty"`        // Extra text printed above the name and version
+	TemplatesDir  string `json:"templates_dir,omitempty"`
+
+	// ResponseCache reuses responses to identical requests within the session
+	ResponseCache bool `json:"response_cache,omitempty"`
+
+	// CacheFile persists the response cache across sessions (-cache-file)
+	CacheFile string `json:"cache_file,omitempty"`
+
+	// ResponseCacheTTL is how long cached responses stay valid, in seconds (default 1 day)
+	ResponseCacheTTL int `json:"response_cache_ttl,omitempty"`
+
+	// ReasoningEffort is sent to reasoning models as reasoning_effort: low, medium, or high
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+
+	// Seed asks the provider for reproducible sampling (-seed); 0 sends none
+	Seed int `json:"seed,omitempty"`
+
+	// ExtraParams are sent in every chat request, e.g. top_p or
+	// frequency_penalty; they can't replace model, messages, or tools
+	ExtraParams map[string]interface{} `json:"extra_params,omitempty"`
+
+	// HistoryFile is where REPL input is saved (default ~/.codequery_history)
+	HistoryFile string `json:"history_file,omitempty"`
+
+	// HistorySize is the number of history entries kept (default 1000)
+	HistorySize int `json:"history_size,omitempty"`
+
+	// EnabledTools limits the model to these tools; empty allows all of them
+	EnabledTools []string `json:"enabled_tools,omitempty"`
+
+	// DisabledTools are never offered to the model
+	DisabledTools []string `json:"disabled_tools,omitempty"`
+
+	// Style asks for "concise" or "detailed" answers; empty leaves it to the model
+	Style string `json:"style,omitempty"`
+
+	// AutoSummarize replaces tool output longer than SummarizeThreshold
+	// characters with a summary from SummarizeModel (-auto-summarize)
+	AutoSummarize      bool   `json:"auto_summarize,omitempty"`
+	SummarizeModel     string `json:"summarize_model,omitempty"`     // Default: Model
+	SummarizeThreshold int    `json:"summarize_threshold,omitempty"` // Default: 20000
+
+	// AutoCompactAfter summarizes older questions once the conversation has
+	// more than this many messages; 0 never compacts
+	AutoCompactAfter int `json:"auto_compact_after,omitempty"`
+
+	// Vision allows -image for models not recognized as multimodal
+	Vision bool `json:"vision,omitempty"`
+
+	// RequestsPerMinute spaces out API requests; 0 means unlimited
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+
+	// Lenient runs tool calls that a model wrote into its answer as JSON (-lenient)
+	Lenient bool `json:"lenient,omitempty"`
+
+	// EncodeBinaryResults base64-encodes tool results containing control characters
+	EncodeBinaryResults bool `json:"encode_binary_results,omitempty"`
+
+	// LabelToolResults starts each tool result with the call that produced
+	// it, for small models that lose track of which result is which
+	LabelToolResults bool `json:"label_tool_results,omitempty"`
+
+	// DetectEncoding makes cat transcode UTF-16 and Latin-1 files to UTF-8
+	DetectEncoding bool `json:"detect_encoding,omitempty"`
+
+	// LanguageNotes starts cat and head output with a comment naming the
+	// file's language, e.g. "// Go source file"
+	LanguageNotes bool `json:"language_notes,omitempty"`
+
+	// MaxReadBytes is the largest file cat will read (default 5MB)
+	MaxReadBytes int64 `json:"max_read_bytes,omitempty"`
+
+	// FullOutputLimit is how many characters cat and grep return when the
+	// model sets full (default 200000); other output stops at 50000
+	FullOutputLimit int `json:"full_output_limit,omitempty"`
+
+	// AutoContinue asks the model to go on when an answer hits the token
+	// limit; otherwise the answer ends with a truncation notice
+	AutoContinue bool `json:"auto_continue,omitempty"`
+
+	// MaxToolIterations caps tool-calling rounds per question (default 25)
+	MaxToolIterations int `json:"max_tool_iterations,omitempty"`
+
+	// PruneIgnoredDirs skips ignored directories (e.g. "node_modules/") in recursive grep/find
+	PruneIgnoredDirs bool `json:"prune_ignored_dirs"`
+
+	// Color enables ANSI colors in terminal output; NO_COLOR always disables them
+	Color bool `json:"color"`
+
+	// Profiles are named sets of settings selected with -profile or
+	// CODEQUERY_PROFILE; a profile's keys override the rest of the file
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
 }
 
+// Values accepted for reasoning_effort
+var reasoningEfforts = []string{"low", "medium", "high"}
+
+// configProfile names the profile to apply (-profile); CODEQUERY_PROFILE is used when empty
+var configProfile string
+
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
-		BaseURL: "https://api.openai.com/v1",
-		Model:   "gpt-4o",
+		BaseURL:           "https://api.openai.com/v1",
+		Model:             "gpt-4o",
+		MaxToolIterations: defaultMaxToolIterations,
+		MaxReadBytes:      defaultMaxReadBytes,
+		FullOutputLimit:   defaultFullOutputLimit,
+		HistorySize:       defaultHistorySize,
+		PruneIgnoredDirs:  true,
+		Color:             true,
 	}
 
 	// Try to load from config file first
-	configPath := getConfigPath()
-	if data, err := os.ReadFile(configPath); err == nil {
-		if err := json.Unmarshal(data, cfg); err != nil {
-			PrintError(fmt.Sprintf("Failed to parse config file %s: %v", configPath, err))
+	loadConfigFile(cfg, getConfigPath())
+
+	// Project settings in .codequery/ override the user config file
+	loadProjectConfig(cfg)
+
+	// The selected profile is the base that environment variables override
+	profile := configProfile
+	if profile == "" {
+		profile = os.Getenv("CODEQUERY_PROFILE")
+	}
+	if profile != "" {
+		if err := applyProfile(cfg, profile); err != nil {
+			return nil, err
 		}
 	}
 
 	// Environment variables override config file
 	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
 		cfg.APIKey = key
+	} else if cfg.APIKeyCommand != "" {
+		key, err := runAPIKeyCommand(cfg.APIKeyCommand)
+		if err != nil {
+			return nil, err
+		}
+		cfg.APIKey = key
 	}
 	if url := os.Getenv("OPENAI_BASE_URL"); url != "" {
 		cfg.BaseURL = url
@@ -37,16 +177,230 @@ func LoadConfig() (*Config, error) {
 	if model := os.Getenv("CODEQUERY_MODEL"); model != "" {
 		cfg.Model = model
 	}
+	if provider := os.Getenv("CODEQUERY_PROVIDER"); provider != "" {
+		cfg.Provider = provider
+	}
+
+	// An explicit provider wins; otherwise infer it from the endpoint
+	if cfg.Provider == "" {
+		cfg.Provider = DetectProvider(cfg.BaseURL)
+	}
+
+	for _, name := range append(slices.Clone(cfg.EnabledTools), cfg.DisabledTools...) {
+		if !HasTool(name) {
+			return nil, fmt.Errorf("unknown tool %q in enabled_tools or disabled_tools", name)
+		}
+	}
+
+	if _, ok := answerStyles[cfg.Style]; !ok && cfg.Style != "" {
+		return nil, fmt.Errorf("invalid style %q (must be concise or detailed)", cfg.Style)
+	}
+
+	if cfg.ReasoningEffort != "" && !slices.Contains(reasoningEfforts, cfg.ReasoningEffort) {
+		return nil, fmt.Errorf("invalid reasoning_effort %q (must be %s)", cfg.ReasoningEffort, strings.Join(reasoningEfforts, ", "))
+	}
 
 	return cfg, nil
 }
 
+// runAPIKeyCommand runs api_key_command through the shell and returns its
+// trimmed output, e.g. for keys kept in a secrets manager
+func runAPIKeyCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("api_key_command failed: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("api_key_command failed: %v", err)
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", fmt.Errorf("api_key_command printed nothing")
+	}
+	return key, nil
+}
+
+// applyProfile merges the named profile's settings into cfg
+func applyProfile(cfg *Config, name string) error {
+	raw, ok := cfg.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q: no profiles are defined in the config file", name)
+		}
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return fmt.Errorf("invalid profile %q: %v", name, err)
+	}
+	return nil
+}
+
+// DetectProvider guesses the API provider from a base URL. Unknown hosts
+// are assumed to be OpenAI-compatible.
+func DetectProvider(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "openai"
+	}
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case host == "api.anthropic.com":
+		return "anthropic"
+	case strings.HasSuffix(host, ".openai.azure.com"):
+		return "azure"
+	case host == "openrouter.ai":
+		return "openrouter"
+	case u.Port() == "11434":
+		return "ollama"
+	default:
+		return "openai"
+	}
+}
+
+// Config file names in order of precedence
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// loadConfigFile merges a config file into cfg, ignoring missing files
+func loadConfigFile(cfg *Config, path string) {
+	if data, err := os.ReadFile(path); err == nil {
+		if err := decodeConfig(data, filepath.Ext(path), cfg); err != nil {
+			PrintError(fmt.Sprintf("Failed to parse config file %s: %v", path, err))
+		}
+	}
+}
+
+// decodeConfig parses JSON, YAML, or TOML into cfg. YAML and TOML are
+// converted to JSON first so the json struct tags apply to every format.
+func decodeConfig(data []byte, ext string, cfg *Config) error {
+	if ext != ".yaml" && ext != ".yml" && ext != ".toml" {
+		return json.Unmarshal(data, cfg)
+	}
+	raw, err := decodeConfigMap(data, ext)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+// decodeConfigMap parses JSON, YAML, or TOML into a map of settings
+func decodeConfigMap(data []byte, ext string) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	var err error
+	switch ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = json.Unmarshal(data, &raw)
+	}
+	return raw, err
+}
+
+// findConfigFile returns the highest-precedence config file present in dir,
+// or the JSON path if none exists
+func findConfigFile(dir string) string {
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, configFileNames[0])
+}
+
+// loadProjectConfig merges the per-repo .codequery/ directory into cfg:
+// config.json (or .yaml/.toml) overrides settings, system.md replaces the system prompt,
+// and templates/ is used as the template directory.
+// The ignore file is picked up separately by LoadIgnorePatterns.
+func loadProjectConfig(cfg *Config) {
+	loadProjectConfigFile(cfg, findConfigFile(projectDir))
+
+	if data, err := os.ReadFile(filepath.Join(projectDir, "system.md")); err == nil {
+		if prompt := strings.TrimSpace(string(data)); prompt != "" {
+			cfg.SystemPrompt = prompt
+		}
+	}
+
+	templates := filepath.Join(projectDir, "templates")
+	if info, err := os.Stat(templates); err == nil && info.IsDir() {
+		cfg.TemplatesDir = templates
+	}
+}
+
+// Settings a project config may set. The repository may not be the
+// user's, so credentials and commands (api_key_command), where requests go
+// (base_url, which would receive the API key), files written outside the
+// repository (history_file, cache_file), and profiles are left to the
+// user's own config file.
+var projectConfigKeys = []string{
+	"model", "system_prompt", "system_append", "app_name", "banner", "style",
+	"reasoning_effort", "seed", "enabled_tools", "disabled_tools",
+	"auto_summarize", "summarize_model", "summarize_threshold", "auto_compact_after",
+	"auto_continue", "max_tool_iterations", "vision", "encode_binary_results",
+	"label_tool_results", "detect_encoding", "language_notes", "max_read_bytes",
+	"full_output_limit", "prune_ignored_dirs", "color",
+}
+
+// loadProjectConfigFile merges a project config file into cfg, dropping
+// settings outside projectConfigKeys with a warning
+func loadProjectConfigFile(cfg *Config, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	raw, err := decodeConfigMap(data, filepath.Ext(path))
+	if err != nil {
+		PrintError(fmt.Sprintf("Failed to parse config file %s: %v", path, err))
+		return
+	}
+	var ignored []string
+	for key := range raw {
+		if !slices.Contains(projectConfigKeys, key) {
+			ignored = append(ignored, key)
+			delete(raw, key)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		PrintError(fmt.Sprintf("Ignoring %s in %s; set them in your own config file instead", strings.Join(ignored, ", "), path))
+	}
+
+	data, err = json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		PrintError(fmt.Sprintf("Failed to parse config file %s: %v", path, err))
+	}
+}
+
 func getConfigPath() string {
+	return findConfigFile(getConfigDir())
+}
+
+func getConfigDir() string {
 	// Check XDG_CONFIG_HOME first
 	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
-		return filepath.Join(xdg, "codequery", "config.json")
+		return filepath.Join(xdg, "codequery")
 	}
 	// Fall back to ~/.config
 	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".config", "codequery", "config.json")
+	return filepath.Join(home, ".config", "codequery")
 }
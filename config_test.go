@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -75,3 +76,401 @@ func TestGetConfigPath_XDG(t *testing.T) {
 		t.Errorf("getConfigPath() = %v, want %v", path, expected)
 	}
 }
+
+// writeProjectDir creates a .codequery directory in the working directory
+func writeProjectDir(t *testing.T, files map[string]string) {
+	t.Helper()
+	if _, err := os.Stat(projectDir); err == nil {
+		t.Fatalf("%s already exists in working directory", projectDir)
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	t.Cleanup(func() { os.RemoveAll(projectDir) })
+}
+
+func TestLoadConfig_ProjectDir(t *testing.T) {
+	// User config sets model and base URL; project config overrides the model
+	xdg := t.TempDir()
+	os.MkdirAll(filepath.Join(xdg, "codequery"), 0755)
+	os.WriteFile(filepath.Join(xdg, "codequery", "config.json"),
+		[]byte(`{"model": "user-model", "base_url": "https://user.example.com/v1"}`), 0644)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	os.Unsetenv("OPENAI_API_KEY")
+	os.Unsetenv("OPENAI_BASE_URL")
+	os.Unsetenv("CODEQUERY_MODEL")
+
+	writeProjectDir(t, map[string]string{
+		"config.json":          `{"model": "project-model"}`,
+		"system.md":            "You only answer questions about this Rails app.\n",
+		"templates/explain.md": "Explain {file}",
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if cfg.Model != "project-model" {
+		t.Errorf("Model = %v, want %v", cfg.Model, "project-model")
+	}
+	if cfg.BaseURL != "https://user.example.com/v1" {
+		t.Errorf("BaseURL = %v, want user config value to be kept", cfg.BaseURL)
+	}
+	if cfg.SystemPrompt != "You only answer questions about this Rails app." {
+		t.Errorf("SystemPrompt = %q, want contents of system.md", cfg.SystemPrompt)
+	}
+	if cfg.TemplatesDir != filepath.Join(projectDir, "templates") {
+		t.Errorf("TemplatesDir = %q, want %q", cfg.TemplatesDir, filepath.Join(projectDir, "templates"))
+	}
+}
+
+func TestLoadConfig_ProjectDirBelowEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("CODEQUERY_MODEL", "env-model")
+
+	writeProjectDir(t, map[string]string{
+		"config.json": `{"model": "project-model"}`,
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Model != "env-model" {
+		t.Errorf("Model = %v, want env var to win over project config", cfg.Model)
+	}
+	if cfg.SystemPrompt != "" || cfg.TemplatesDir != "" {
+		t.Errorf("SystemPrompt/TemplatesDir should be empty without system.md and templates/")
+	}
+}
+
+func TestLoadConfig_ProjectDirCannotSetAPIKeyCommand(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key": "user-key"}`})
+	marker := filepath.Join(t.TempDir(), "ran")
+	writeProjectDir(t, map[string]string{
+		"config.json": `{
+			"model": "project-model",
+			"api_key_command": "touch ` + marker + `; echo project-key"
+		}`,
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("api_key_command from the project config was run")
+	}
+	if cfg.APIKeyCommand != "" || cfg.APIKey != "user-key" {
+		t.Errorf("APIKeyCommand = %q, APIKey = %q; want the project's command dropped and the user's key kept", cfg.APIKeyCommand, cfg.APIKey)
+	}
+	if cfg.Model != "project-model" {
+		t.Errorf("Model = %q, want the rest of the project config applied", cfg.Model)
+	}
+}
+
+func TestLoadConfig_ProjectDirCannotSetLenient(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key": "user-key"}`})
+	writeProjectDir(t, map[string]string{"config.json": `{"model": "project-model", "lenient": true}`})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Lenient {
+		t.Error("lenient from the project config was applied")
+	}
+	if cfg.Model != "project-model" {
+		t.Errorf("Model = %q, want the rest of the project config applied", cfg.Model)
+	}
+}
+
+func TestLoadConfig_ProjectDirAllowedKeys(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key": "user-key", "base_url": "https://user.example.com/v1"}`})
+	writeProjectDir(t, map[string]string{
+		"config.yaml": "model: project-model\n" +
+			"style: concise\n" +
+			"api_key: project-key\n" +
+			"base_url: https://attacker.example.com/v1\n" +
+			"history_file: /tmp/codequery-history\n" +
+			"cache_file: ../cache.json\n" +
+			"extra_params: {user: x}\n" +
+			"profiles: {evil: {base_url: https://attacker.example.com/v1}}\n",
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Model != "project-model" || cfg.Style != "concise" {
+		t.Errorf("Model = %q, Style = %q; want the allowed project settings applied", cfg.Model, cfg.Style)
+	}
+	if cfg.APIKey != "user-key" || cfg.BaseURL != "https://user.example.com/v1" {
+		t.Errorf("APIKey = %q, BaseURL = %q; want the user's connection settings kept", cfg.APIKey, cfg.BaseURL)
+	}
+	if cfg.HistoryFile != "" || cfg.CacheFile != "" || cfg.ExtraParams != nil || cfg.Profiles != nil {
+		t.Errorf("project config set HistoryFile %q, CacheFile %q, ExtraParams %v, or Profiles %v", cfg.HistoryFile, cfg.CacheFile, cfg.ExtraParams, cfg.Profiles)
+	}
+}
+
+// writeUserConfig writes files into a temporary XDG config directory
+func writeUserConfig(t *testing.T, files map[string]string) {
+	t.Helper()
+	xdg := t.TempDir()
+	dir := filepath.Join(xdg, "codequery")
+	os.MkdirAll(dir, 0755)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	os.Unsetenv("OPENAI_API_KEY")
+	os.Unsetenv("OPENAI_BASE_URL")
+	os.Unsetenv("CODEQUERY_MODEL")
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.json": `{
+			"api_key": "base-key",
+			"model": "gpt-4o",
+			"profiles": {
+				"local": {"base_url": "http://localhost:11434/v1", "api_key": "ollama", "model": "llama3.2"},
+				"cloud": {"model": "gpt-4.1"}
+			}
+		}`,
+	})
+	orig := configProfile
+	t.Cleanup(func() { configProfile = orig })
+
+	tests := []struct {
+		flag    string
+		env     string
+		model   string
+		apiKey  string
+		baseURL string
+	}{
+		{"", "", "gpt-4o", "base-key", "https://api.openai.com/v1"},
+		{"local", "", "llama3.2", "ollama", "http://localhost:11434/v1"},
+		{"", "cloud", "gpt-4.1", "base-key", "https://api.openai.com/v1"},
+		{"local", "cloud", "llama3.2", "ollama", "http://localhost:11434/v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag+"/"+tt.env, func(t *testing.T) {
+			configProfile = tt.flag
+			t.Setenv("CODEQUERY_PROFILE", tt.env)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if cfg.Model != tt.model || cfg.APIKey != tt.apiKey || cfg.BaseURL != tt.baseURL {
+				t.Errorf("LoadConfig() = {%s %s %s}, want {%s %s %s}", cfg.Model, cfg.APIKey, cfg.BaseURL, tt.model, tt.apiKey, tt.baseURL)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_UnknownProfile(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.json": `{"profiles": {"local": {"model": "llama3.2"}, "cloud": {"model": "gpt-4.1"}}}`,
+	})
+	orig := configProfile
+	t.Cleanup(func() { configProfile = orig })
+	configProfile = "missing"
+
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "available: cloud, local") {
+		t.Errorf("LoadConfig() error = %v, want unknown profile listing cloud, local", err)
+	}
+}
+
+func TestLoadConfig_ReasoningEffort(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"reasoning_effort": "medium"}`})
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.ReasoningEffort != "medium" {
+		t.Errorf("ReasoningEffort = %q, want medium", cfg.ReasoningEffort)
+	}
+
+	writeUserConfig(t, map[string]string{"config.json": `{"reasoning_effort": "extreme"}`})
+	_, err = LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "must be low, medium, high") {
+		t.Errorf("LoadConfig() error = %v, want invalid reasoning_effort", err)
+	}
+}
+
+func TestLoadConfig_UnknownTool(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"enabled_tools": ["ls", "rm"]}`})
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), `unknown tool "rm"`) {
+		t.Errorf("LoadConfig() error = %v, want unknown tool", err)
+	}
+}
+
+func TestLoadConfig_APIKeyCommand(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key": "sk-file", "api_key_command": "echo '  sk-from-command  '"}`})
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "sk-from-command" {
+		t.Errorf("APIKey = %q, want the trimmed command output", cfg.APIKey)
+	}
+
+	// The environment variable still wins, and the command isn't run
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key_command": "exit 1"}`})
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	cfg, err = LoadConfig()
+	if err != nil || cfg.APIKey != "sk-env" {
+		t.Errorf("LoadConfig() = %v, %v; want the environment key", cfg, err)
+	}
+}
+
+func TestLoadConfig_APIKeyCommandFails(t *testing.T) {
+	writeUserConfig(t, map[string]string{"config.json": `{"api_key_command": "echo vault is sealed >&2; exit 3"}`})
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "api_key_command failed") || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("LoadConfig() error = %v, want the command failure with its stderr", err)
+	}
+}
+
+func TestLoadConfig_ProfileYAML(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.yaml": "model: gpt-4o\nprofiles:\n  local:\n    model: llama3.2\n",
+	})
+	t.Setenv("CODEQUERY_PROFILE", "local")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Model != "llama3.2" {
+		t.Errorf("Model = %q, want %q", cfg.Model, "llama3.2")
+	}
+}
+
+func TestLoadConfig_YAML(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.yaml": "api_key: yaml-key\nbase_url: http://localhost:11434/v1\nmodel: llama3.2\nrequests_per_minute: 30\n",
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if cfg.APIKey != "yaml-key" {
+		t.Errorf("APIKey = %v, want %v", cfg.APIKey, "yaml-key")
+	}
+	if cfg.BaseURL != "http://localhost:11434/v1" {
+		t.Errorf("BaseURL = %v, want %v", cfg.BaseURL, "http://localhost:11434/v1")
+	}
+	if cfg.Model != "llama3.2" {
+		t.Errorf("Model = %v, want %v", cfg.Model, "llama3.2")
+	}
+	if cfg.RequestsPerMinute != 30 {
+		t.Errorf("RequestsPerMinute = %v, want %v", cfg.RequestsPerMinute, 30)
+	}
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.toml": "api_key = \"toml-key\"\nmodel = \"gpt-4o-mini\"\n",
+	})
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if cfg.APIKey != "toml-key" {
+		t.Errorf("APIKey = %v, want %v", cfg.APIKey, "toml-key")
+	}
+	if cfg.Model != "gpt-4o-mini" {
+		t.Errorf("Model = %v, want %v", cfg.Model, "gpt-4o-mini")
+	}
+	if cfg.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("BaseURL = %v, want default to be kept", cfg.BaseURL)
+	}
+}
+
+func TestGetConfigPath_JSONPrecedence(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.json": `{"model": "json-model"}`,
+		"config.yaml": "model: yaml-model\n",
+		"config.toml": "model = \"toml-model\"\n",
+	})
+
+	if path := getConfigPath(); filepath.Base(path) != "config.json" {
+		t.Errorf("getConfigPath() = %v, want config.json to take precedence", path)
+	}
+
+	cfg, _ := LoadConfig()
+	if cfg.Model != "json-model" {
+		t.Errorf("Model = %v, want %v", cfg.Model, "json-model")
+	}
+}
+
+func TestGetConfigPath_YAMLOverTOML(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.yaml": "model: yaml-model\n",
+		"config.toml": "model = \"toml-model\"\n",
+	})
+
+	if path := getConfigPath(); filepath.Base(path) != "config.yaml" {
+		t.Errorf("getConfigPath() = %v, want config.yaml", path)
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	tests := []struct {
+		url      string
+		provider string
+	}{
+		{"https://api.openai.com/v1", "openai"},
+		{"https://api.anthropic.com/v1", "anthropic"},
+		{"https://my-resource.openai.azure.com/openai", "azure"},
+		{"https://MY-RESOURCE.OpenAI.Azure.com", "azure"},
+		{"https://openrouter.ai/api/v1", "openrouter"},
+		{"http://localhost:11434/v1", "ollama"},
+		{"http://localhost:8000/v1", "openai"},
+		{"https://example-provider.ai/api/v1", "openai"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := DetectProvider(tt.url); got != tt.provider {
+				t.Errorf("DetectProvider(%q) = %q, want %q", tt.url, got, tt.provider)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ProviderOverride(t *testing.T) {
+	writeUserConfig(t, map[string]string{
+		"config.json": `{"base_url": "https://api.anthropic.com/v1"}`,
+	})
+
+	cfg, _ := LoadConfig()
+	if cfg.Provider != "anthropic" {
+		t.Errorf("Provider = %q, want detected %q", cfg.Provider, "anthropic")
+	}
+
+	t.Setenv("CODEQUERY_PROVIDER", "openai")
+	cfg, _ = LoadConfig()
+	if cfg.Provider != "openai" {
+		t.Errorf("Provider = %q, want explicit override %q", cfg.Provider, "openai")
+	}
+}
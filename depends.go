@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Directories that never contain first-party packages worth scanning
+var skippedImportDirs = map[string]bool{
+	"vendor":       true,
+	"node_modules": true,
+	"testdata":     true,
+}
+
+// findGoModule walks up from start looking for a go.mod and returns the
+// module root directory and module path
+func findGoModule(start string) (string, string, error) {
+	dir := start
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			scanner := bufio.NewScanner(strings.NewReader(string(data)))
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if strings.HasPrefix(line, "module ") {
+					modPath := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+					return dir, modPath, nil
+				}
+			}
+			return "", "", fmt.Errorf("no module declaration in %s", filepath.Join(dir, "go.mod"))
+		}
+		// Stop at the working directory; never look outside it
+		if dir == "." || dir == filepath.Dir(dir) {
+			return "", "", fmt.Errorf("no go.mod found for %s", start)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// fileImports returns the import paths declared in a Go source file
+func fileImports(fset *token.FileSet, path string) ([]string, error) {
+	f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var imports []string
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			imports = append(imports, p)
+		}
+	}
+	return imports, nil
+}
+
+// localImportDir maps an import path to a package directory inside the module,
+// returning false for imports from outside the module
+func localImportDir(root, modPath, importPath string) (string, bool) {
+	if importPath == modPath {
+		return root, true
+	}
+	if !strings.HasPrefix(importPath, modPath+"/") {
+		return "", false
+	}
+	return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(importPath, modPath+"/"))), true
+}
+
+// buildImportGraph maps every package directory under root to the
+// module-local package directories it imports. Test files are ignored.
+func buildImportGraph(ctx context.Context, root, modPath string) (map[string][]string, error) {
+	fset := token.NewFileSet()
+	graph := make(map[string][]string)
+	seen := make(map[string]map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("dependency scan timed out")
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || skippedImportDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") || IsPathBlocked(path) {
+			return nil
+		}
+
+		imports, err := fileImports(fset, path)
+		if err != nil {
+			return nil // Skip files that don't parse
+		}
+		pkg := filepath.Dir(path)
+		if seen[pkg] == nil {
+			seen[pkg] = make(map[string]bool)
+		}
+		for _, imp := range imports {
+			dep, ok := localImportDir(root, modPath, imp)
+			if !ok || dep == pkg || seen[pkg][dep] {
+				continue
+			}
+			seen[pkg][dep] = true
+			graph[pkg] = append(graph[pkg], dep)
+		}
+		return nil
+	})
+	return graph, err
+}
+
+// findImportChain does a breadth-first search from the starting packages to
+// target, returning the shortest chain of package directories (nil if none)
+func findImportChain(graph map[string][]string, start []string, target string) []string {
+	parent := make(map[string]string)
+	visited := make(map[string]bool)
+	queue := append([]string{}, start...)
+	for _, s := range start {
+		visited[s] = true
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == target {
+			chain := []string{cur}
+			for p, ok := parent[cur]; ok; p, ok = parent[p] {
+				chain = append([]string{p}, chain...)
+			}
+			return chain
+		}
+		for _, next := range graph[cur] {
+			if !visited[next] {
+				visited[next] = true
+				parent[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// relativeToCwd cleans a path and makes absolute paths relative to the
+// working directory so graph keys compare consistently
+func relativeToCwd(path string) string {
+	path = filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		if cwd, err := filepath.Abs("."); err == nil {
+			if rel, err := filepath.Rel(cwd, path); err == nil {
+				return rel
+			}
+		}
+	}
+	return path
+}
+
+func executeDependsOn(ctx context.Context, args map[string]interface{}) (string, error) {
+	from := getString(args, "from", "")
+	to := getString(args, "to", "")
+	if from == "" || to == "" {
+		return "", fmt.Errorf("from and to are required")
+	}
+
+	for _, p := range []string{from, to} {
+		if IsPathBlocked(p) {
+			return "", fmt.Errorf("access denied: %s is in ignore list", p)
+		}
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("path does not exist: %s", p)
+		}
+	}
+	from, to = relativeToCwd(from), relativeToCwd(to)
+
+	// Resolve the package directory each side refers to
+	fromPkg, toPkg := from, to
+	fromInfo, _ := os.Stat(from)
+	if !fromInfo.IsDir() {
+		fromPkg = filepath.Dir(from)
+	}
+	if toInfo, _ := os.Stat(to); !toInfo.IsDir() {
+		toPkg = filepath.Dir(to)
+	}
+
+	if fromPkg == toPkg {
+		return fmt.Sprintf("%s and %s are in the same package (%s)", from, to, toPkg), nil
+	}
+
+	root, modPath, err := findGoModule(fromPkg)
+	if err != nil {
+		return "", err
+	}
+
+	graph, err := buildImportGraph(ctx, root, modPath)
+	if err != nil {
+		return "", err
+	}
+
+	// A single file only reaches what it imports itself
+	start := []string{fromPkg}
+	if !fromInfo.IsDir() {
+		if !strings.HasSuffix(from, ".go") {
+			return "", fmt.Errorf("only Go files are supported: %s", from)
+		}
+		imports, err := fileImports(token.NewFileSet(), from)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %v", from, err)
+		}
+		start = nil
+		for _, imp := range imports {
+			if dep, ok := localImportDir(root, modPath, imp); ok {
+				start = append(start, dep)
+			}
+		}
+	}
+
+	chain := findImportChain(graph, start, toPkg)
+	if chain == nil {
+		return fmt.Sprintf("%s does not depend on %s", from, to), nil
+	}
+	if !fromInfo.IsDir() {
+		chain = append([]string{from}, chain...)
+	}
+
+	kind := "directly"
+	if len(chain) > 2 {
+		kind = fmt.Sprintf("transitively (%d hops)", len(chain)-1)
+	}
+	return fmt.Sprintf("%s depends on %s %s\nImport chain: %s", from, to, kind, strings.Join(chain, " -> ")), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDependsFixture creates a small Go module with an a -> b -> c import chain
+func writeDependsFixture(t *testing.T) string {
+	t.Helper()
+	root := "test_depends_fixture"
+	files := map[string]string{
+		"go.mod":  "module example.com/fixture\n\ngo 1.21\n",
+		"a/a.go":  "package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/fixture/b\"\n)\n\nfunc A() { fmt.Println(b.B()) }\n",
+		"b/b.go":  "package b\n\nimport \"example.com/fixture/c\"\n\nfunc B() string { return c.C() }\n",
+		"c/c.go":  "package c\n\nfunc C() string { return \"c\" }\n",
+		"d/d.go":  "package d\n\nfunc D() {}\n",
+		"a/x.go":  "package a\n\nfunc X() {}\n",
+		"b/b2.go": "package b\n\nimport \"example.com/fixture/c\"\n\nvar _ = c.C\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write fixture file: %v", err)
+		}
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	return root
+}
+
+func TestExecuteTool_DependsOn_Transitive(t *testing.T) {
+	root := writeDependsFixture(t)
+
+	args := `{"from": "test_depends_fixture/a", "to": "test_depends_fixture/c"}`
+	result, err := ExecuteTool("depends_on", args)
+	if err != nil {
+		t.Fatalf("ExecuteTool depends_on error: %v", err)
+	}
+
+	chain := strings.Join([]string{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "b"),
+		filepath.Join(root, "c"),
+	}, " -> ")
+	if !strings.Contains(result, chain) {
+		t.Errorf("depends_on should report chain %q, got: %s", chain, result)
+	}
+	if !strings.Contains(result, "transitively") {
+		t.Errorf("depends_on should report a transitive dependency, got: %s", result)
+	}
+}
+
+func TestExecuteTool_DependsOn_Direct(t *testing.T) {
+	writeDependsFixture(t)
+
+	result, err := ExecuteTool("depends_on", `{"from": "test_depends_fixture/b", "to": "test_depends_fixture/c/c.go"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool depends_on error: %v", err)
+	}
+	if !strings.Contains(result, "directly") {
+		t.Errorf("depends_on should report a direct dependency, got: %s", result)
+	}
+}
+
+func TestExecuteTool_DependsOn_FromFile(t *testing.T) {
+	writeDependsFixture(t)
+
+	// a/x.go imports nothing even though package a reaches c
+	result, err := ExecuteTool("depends_on", `{"from": "test_depends_fixture/a/x.go", "to": "test_depends_fixture/c"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool depends_on error: %v", err)
+	}
+	if !strings.Contains(result, "does not depend on") {
+		t.Errorf("a/x.go should not depend on c, got: %s", result)
+	}
+
+	result, err = ExecuteTool("depends_on", `{"from": "test_depends_fixture/a/a.go", "to": "test_depends_fixture/c"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool depends_on error: %v", err)
+	}
+	if !strings.Contains(result, "test_depends_fixture/a/a.go -> ") {
+		t.Errorf("chain should start at the file, got: %s", result)
+	}
+}
+
+func TestExecuteTool_DependsOn_NoDependency(t *testing.T) {
+	writeDependsFixture(t)
+
+	result, err := ExecuteTool("depends_on", `{"from": "test_depends_fixture/c", "to": "test_depends_fixture/a"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool depends_on error: %v", err)
+	}
+	if !strings.Contains(result, "does not depend on") {
+		t.Errorf("c should not depend on a, got: %s", result)
+	}
+}
+
+func TestExecuteTool_DependsOn_MissingArgs(t *testing.T) {
+	_, err := ExecuteTool("depends_on", `{"from": "."}`)
+	if err == nil {
+		t.Error("depends_on without to should return error")
+	}
+}
+
+func TestExecuteTool_DependsOn_PathTraversal(t *testing.T) {
+	_, err := ExecuteTool("depends_on", `{"from": ".", "to": "../../etc"}`)
+	if err == nil {
+		t.Error("depends_on with path traversal should return error")
+	}
+}
+
+func TestBuildImportGraph_Timeout(t *testing.T) {
+	root := writeDependsFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := buildImportGraph(ctx, root, "example.com/fixture")
+	if err == nil {
+		t.Error("buildImportGraph with cancelled context should return error")
+	}
+}
+
+func TestFindImportChain(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b", "d"},
+		"b": {"c"},
+		"d": {"c"},
+	}
+
+	chain := findImportChain(graph, []string{"a"}, "c")
+	if len(chain) != 3 || chain[0] != "a" || chain[2] != "c" {
+		t.Errorf("findImportChain() = %v, want a -> ? -> c", chain)
+	}
+	if chain := findImportChain(graph, []string{"c"}, "a"); chain != nil {
+		t.Errorf("findImportChain(c, a) = %v, want nil", chain)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// detectEncoding makes cat transcode UTF-16 and Latin-1 files to UTF-8 (detect_encoding)
+var detectEncoding bool
+
+// transcodeToUTF8 converts text that isn't UTF-8 into UTF-8. It recognizes
+// UTF-16 by its byte order mark or by the zero bytes ASCII text has in every
+// other position, and treats any other invalid UTF-8 as Latin-1. It returns
+// the name of the detected encoding, or "" when data was already UTF-8.
+func transcodeToUTF8(data []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "UTF-8 with BOM"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian), "UTF-16LE"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian), "UTF-16BE"
+	}
+
+	if order, name, ok := guessUTF16(data); ok {
+		return decodeUTF16(data, order), name
+	}
+
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+
+	// Latin-1 bytes are the first 256 code points
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes), "Latin-1"
+}
+
+// guessUTF16 looks for BOM-less UTF-16: mostly-ASCII text has a zero byte
+// in every other position
+func guessUTF16(data []byte) (binary.ByteOrder, string, bool) {
+	sample := data[:min(len(data), 4096)]
+	if len(sample) < 4 || len(data)%2 != 0 {
+		return nil, "", false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 >= pairs*9 && evenZeros*10 < pairs:
+		return binary.LittleEndian, "UTF-16LE", true
+	case evenZeros*10 >= pairs*9 && oddZeros*10 < pairs:
+		return binary.BigEndian, "UTF-16BE", true
+	}
+	return nil, "", false
+}
+
+// decodeUTF16 converts UTF-16 bytes in the given order to a UTF-8 string
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
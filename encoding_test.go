@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16LE encodes s as little-endian UTF-16, optionally with a byte order mark
+func utf16LE(s string, bom bool) []byte {
+	var out []byte
+	if bom {
+		out = append(out, 0xFF, 0xFE)
+	}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+func TestTranscodeToUTF8(t *testing.T) {
+	text := "héllo wörld\nline two"
+	tests := []struct {
+		name     string
+		data     []byte
+		want     string
+		encoding string
+	}{
+		{"utf-8", []byte(text), text, ""},
+		{"utf-16le bom", utf16LE(text, true), text, "UTF-16LE"},
+		{"utf-16le no bom", utf16LE(text, false), text, "UTF-16LE"},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0x00, 'h', 0x00, 'i'}, "hi", "UTF-16BE"},
+		{"latin-1", []byte{'c', 'a', 'f', 0xE9}, "café", "Latin-1"},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "hi"...), "hi", "UTF-8 with BOM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding := transcodeToUTF8(tt.data)
+			if got != tt.want || encoding != tt.encoding {
+				t.Errorf("transcodeToUTF8() = (%q, %q), want (%q, %q)", got, encoding, tt.want, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestExecuteTool_CatDetectEncoding(t *testing.T) {
+	if err := os.WriteFile("test_utf16.txt", utf16LE("Hello from UTF-16\n", true), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove("test_utf16.txt")
+
+	// Off by default: the raw bytes come back
+	raw, err := ExecuteTool("cat", `{"path": "test_utf16.txt"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool cat error: %v", err)
+	}
+	if strings.Contains(raw, "Hello from UTF-16") {
+		t.Error("cat should not transcode unless detect_encoding is set")
+	}
+
+	detectEncoding = true
+	defer func() { detectEncoding = false }()
+
+	result, err := ExecuteTool("cat", `{"path": "test_utf16.txt"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool cat error: %v", err)
+	}
+	want := "Hello from UTF-16\n\n[transcoded from UTF-16LE to UTF-8]"
+	if result != want {
+		t.Errorf("cat with detect_encoding = %q, want %q", result, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func executeGitDiff(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	// Without a path, diff the current directory rather than the whole
+	// repository, which may reach outside it (e.g. under -cwd)
+	pathspec := "."
+	if path != "" {
+		clean, err := validatePath(path)
+		if err != nil {
+			return "", err
+		}
+		if IsPathBlocked(path) {
+			return "", fmt.Errorf("access denied: %s is in ignore list", path)
+		}
+		pathspec = clean
+	}
+
+	// Outside a repository git diff falls back to comparing HEAD and the
+	// pathspec as plain files, so check for one first
+	if _, err := runGit(ctx, "rev-parse", "--git-dir"); err != nil {
+		return "", err
+	}
+	output, err := runGit(ctx, "diff", "HEAD", "--", pathspec)
+	if err != nil {
+		return "", err
+	}
+
+	diff := filterBlockedDiffs(output)
+	if strings.TrimSpace(diff) == "" {
+		if path != "" {
+			return fmt.Sprintf("No changes to %s since the last commit", path), nil
+		}
+		return "No changes since the last commit", nil
+	}
+	return truncateOutput(diff), nil
+}
+
+func executeGitShow(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	rev := getString(args, "rev", "HEAD")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid revision %q", rev)
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+
+	// "./" makes the path relative to the current directory rather than
+	// the repository root
+	output, err := runGit(ctx, "show", rev+":./"+filepath.ToSlash(filepath.Clean(path)))
+	if err != nil {
+		return "", err
+	}
+	return truncateOutput(output), nil
+}
+
+// runGit runs a git subcommand and returns its output. Exit status 1 is
+// success (git diff --exit-code style); other failures become errors that
+// say why, such as not being in a repository.
+func runGit(ctx context.Context, args ...string) (string, error) {
+	if _, err := lookPath("git"); err != nil {
+		return "", fmt.Errorf("git is not installed")
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return string(output), nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command timed out")
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return string(output), nil
+	}
+	msg := strings.TrimSpace(string(output))
+	switch {
+	case strings.Contains(strings.ToLower(msg), "not a git repository"):
+		return "", fmt.Errorf("the current directory is not in a git repository")
+	case strings.Contains(msg, "bad revision 'HEAD'"), strings.Contains(msg, "unknown revision"):
+		return "", fmt.Errorf("the repository has no commits yet")
+	case strings.Contains(msg, "does not exist in"), strings.Contains(msg, "exists on disk, but not in"):
+		return "", fmt.Errorf("%s", strings.TrimPrefix(msg, "fatal: "))
+	case strings.Contains(msg, "invalid object name"):
+		return "", fmt.Errorf("unknown revision: %s", strings.TrimSuffix(strings.TrimPrefix(msg, "fatal: invalid object name "), "."))
+	case msg == "":
+		return "", err
+	}
+	return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+}
+
+// filterBlockedDiffs drops the sections of a diff for files in the ignore
+// list, so a diff of the whole tree doesn't reveal their contents
+func filterBlockedDiffs(diff string) string {
+	var b strings.Builder
+	skip := false
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if header, ok := strings.CutPrefix(line, "diff --git "); ok {
+			skip = false
+			for _, name := range strings.Fields(header) {
+				name = strings.TrimPrefix(strings.TrimPrefix(name, "a/"), "b/")
+				if IsPathBlocked(name) {
+					skip = true
+				}
+			}
+		}
+		if !skip {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
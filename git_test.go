@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// initGitRepo changes into a new repository with one commit of files
+func initGitRepo(t *testing.T, files map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	orig, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(orig) })
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Chdir() error = %v", err)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+}
+
+func TestExecuteTool_GitDiff(t *testing.T) {
+	initGitRepo(t, map[string]string{"main.go": "package main\n\nfunc old() {}\n", "other.go": "package main\n"})
+	os.WriteFile("main.go", []byte("package main\n\nfunc updated() {}\n"), 0644)
+	os.WriteFile("other.go", []byte("package main\n\nvar x = 1\n"), 0644)
+
+	result, err := ExecuteTool("git_diff", `{"path": "main.go"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool git_diff error: %v", err)
+	}
+	for _, want := range []string{"diff --git a/main.go b/main.go", "-func old() {}", "+func updated() {}"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("git_diff output missing %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "other.go") {
+		t.Errorf("git_diff with a path should only show that file, got:\n%s", result)
+	}
+
+	if result, _ := ExecuteTool("git_diff", `{}`); !strings.Contains(result, "main.go") || !strings.Contains(result, "+var x = 1") {
+		t.Errorf("git_diff without a path should show every change, got:\n%s", result)
+	}
+}
+
+func TestExecuteTool_GitDiff_Subdirectory(t *testing.T) {
+	initGitRepo(t, map[string]string{"root.go": "package main\n"})
+	os.Mkdir("sub", 0755)
+	os.WriteFile("sub/inner.go", []byte("package sub\n"), 0644)
+	for _, args := range [][]string{
+		{"add", "."},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "sub"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	os.WriteFile("root.go", []byte("package main\n\n// outside\n"), 0644)
+	os.WriteFile("sub/inner.go", []byte("package sub\n\n// inside\n"), 0644)
+	os.Chdir("sub")
+
+	result, err := ExecuteTool("git_diff", `{}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool git_diff error: %v", err)
+	}
+	if !strings.Contains(result, "// inside") || strings.Contains(result, "// outside") {
+		t.Errorf("git_diff from a subdirectory should only show changes under it, got:\n%s", result)
+	}
+
+	if _, err := executeGitDiff(context.Background(), map[string]interface{}{"path": "../root.go"}); err == nil || !strings.Contains(err.Error(), "path traversal") {
+		t.Errorf("git_diff of a path outside the directory error = %v, want path traversal", err)
+	}
+}
+
+func TestExecuteTool_GitDiff_NoChanges(t *testing.T) {
+	initGitRepo(t, map[string]string{"main.go": "package main\n"})
+
+	result, err := ExecuteTool("git_diff", `{"path": "main.go"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool git_diff error: %v", err)
+	}
+	if result != "No changes to main.go since the last commit" {
+		t.Errorf("git_diff = %q, want a no-changes message", result)
+	}
+}
+
+func TestExecuteTool_GitDiff_Blocked(t *testing.T) {
+	initGitRepo(t, map[string]string{".env": "TOKEN=old\n", "main.go": "package main\n"})
+	os.WriteFile(".env", []byte("TOKEN=secret\n"), 0644)
+	os.WriteFile("main.go", []byte("package main\n\n// changed\n"), 0644)
+
+	if _, err := ExecuteTool("git_diff", `{"path": ".env"}`); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("git_diff of a blocked file should be denied, got: %v", err)
+	}
+	result, err := ExecuteTool("git_diff", `{}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool git_diff error: %v", err)
+	}
+	if strings.Contains(result, "secret") || !strings.Contains(result, "// changed") {
+		t.Errorf("git_diff should leave out blocked files, got:\n%s", result)
+	}
+}
+
+func TestExecuteTool_GitDiff_NotARepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	orig, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(orig) })
+	dir := t.TempDir()
+	os.Chdir(dir)
+	t.Setenv("GIT_CEILING_DIRECTORIES", dir)
+
+	_, err := ExecuteTool("git_diff", `{}`)
+	if err == nil || !strings.Contains(err.Error(), "not in a git repository") {
+		t.Errorf("git_diff outside a repository error = %v, want not in a git repository", err)
+	}
+}
+
+func TestExecuteTool_GitShow(t *testing.T) {
+	initGitRepo(t, map[string]string{"main.go": "package main\n\nfunc old() {}\n"})
+	os.WriteFile("main.go", []byte("package main\n\nfunc updated() {}\n"), 0644)
+
+	result, err := ExecuteTool("git_show", `{"path": "main.go"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool git_show error: %v", err)
+	}
+	if !strings.Contains(result, "func old()") || strings.Contains(result, "func updated()") {
+		t.Errorf("git_show should return the committed version, got:\n%s", result)
+	}
+	if result, _ := ExecuteTool("git_show", `{"path": "./main.go", "rev": "HEAD"}`); !strings.Contains(result, "func old()") {
+		t.Errorf("git_show with rev HEAD = %q, want the committed version", result)
+	}
+}
+
+func TestExecuteTool_GitShow_Errors(t *testing.T) {
+	initGitRepo(t, map[string]string{"main.go": "package main\n", ".env": "SECRET=1\n"})
+	os.WriteFile("new.go", []byte("package main\n"), 0644)
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"blocked", `{"path": ".env"}`, "access denied"},
+		{"missing path", `{"path": "missing.go"}`, "does not exist in 'HEAD'"},
+		{"not committed", `{"path": "new.go"}`, "not in 'HEAD'"},
+		{"unknown rev", `{"path": "main.go", "rev": "HEAD~5"}`, "unknown revision"},
+		{"option rev", `{"path": "main.go", "rev": "--output=x"}`, "invalid revision"},
+		{"no path", `{}`, "path is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteTool("git_show", tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("git_show error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -26,18 +30,90 @@ var defaultBlockedPatterns = []string{
 	".netrc",
 	".npmrc",
 	".pypirc",
+	".git/",
 }
 
 var blockedPatterns []string
 
-// LoadIgnorePatterns loads patterns from .codequeryignore and combines with defaults
+// A size rule such as "size>1MB" in an ignore file blocks every file larger
+// than blockedSize, whatever its name. The smallest rule wins.
+var (
+	blockedSize     int64
+	blockedSizeRule string
+)
+
+// Prefix of size rules in ignore files
+const sizeRulePrefix = "size>"
+
+// Units accepted in size rules
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// secretPattern describes a recognizable secret value
+type secretPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Secret values that shouldn't be written out even when found in allowed files
+var secretPatterns = []secretPattern{
+	{"API key", regexp.MustCompile(`sk-(?:proj-|ant-|or-v1-)?[A-Za-z0-9_-]{20,}`)},
+	{"AWS access key", regexp.MustCompile(`AKIA[0-9A-Z]{16}`)},
+	{"GitHub token", regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`)},
+	{"Slack token", regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// Replacement for secrets removed from tool output
+const redactedSecret = "***REDACTED***"
+
+// redactOutput replaces secrets in tool output before the model sees it (-redact)
+var redactOutput bool
+
+// FindSecret returns the first secret pattern that matches content
+func FindSecret(content string) (secretPattern, bool) {
+	for _, p := range secretPatterns {
+		if p.re.MatchString(content) {
+			return p, true
+		}
+	}
+	return secretPattern{}, false
+}
+
+// RedactSecrets replaces every value matching a secret pattern with
+// ***REDACTED***
+func RedactSecrets(content string) string {
+	for _, p := range secretPatterns {
+		content = p.re.ReplaceAllString(content, redactedSecret)
+	}
+	return content
+}
+
+// pruneIgnoredDirs makes recursive grep/find skip directories listed in the
+// ignore patterns (entries ending in "/"), set from Config.PruneIgnoredDirs
+var pruneIgnoredDirs = true
+
+// LoadIgnorePatterns loads patterns from .codequeryignore and .codequery/ignore
+// and combines them with defaults
 func LoadIgnorePatterns() {
 	blockedPatterns = append(blockedPatterns, defaultBlockedPatterns...)
+	blockedSize, blockedSizeRule = 0, ""
+
+	// Try to load ignore files from current directory
+	loadIgnoreFile(".codequeryignore")
+	loadIgnoreFile(filepath.Join(projectDir, "ignore"))
+}
 
-	// Try to load .codequeryignore from current directory
-	file, err := os.Open(".codequeryignore")
+// loadIgnoreFile appends patterns from a gitignore-style file
+func loadIgnoreFile(path string) {
+	file, err := os.Open(path)
 	if err != nil {
-		return // File doesn't exist, just use defaults
+		return // File doesn't exist, nothing to add
 	}
 	defer file.Close()
 
@@ -48,35 +124,122 @@ func LoadIgnorePatterns() {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		if rule, ok := strings.CutPrefix(strings.ReplaceAll(line, " ", ""), sizeRulePrefix); ok {
+			size, err := parseSize(rule)
+			if err != nil {
+				PrintError(fmt.Sprintf("%s: ignoring %q: %v", path, line, err))
+				continue
+			}
+			if blockedSize == 0 || size < blockedSize {
+				blockedSize, blockedSizeRule = size, sizeRulePrefix+rule
+			}
+			continue
+		}
 		blockedPatterns = append(blockedPatterns, line)
 	}
 }
 
+// parseSize reads a size such as "1MB", "500K", or "2048" (bytes)
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if number, ok := strings.CutSuffix(upper, unit.suffix); ok {
+			upper, multiplier = number, unit.bytes
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(upper, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500KB or 1MB)", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
 // IsPathBlocked checks if a path matches any blocked pattern
 func IsPathBlocked(path string) bool {
+	_, blocked := MatchBlockedPattern(path)
+	return blocked
+}
+
+// MatchBlockedPattern reports whether path is blocked and, if so, the first
+// ignore pattern that matched it
+func MatchBlockedPattern(path string) (string, bool) {
 	// Normalize the path
 	path = filepath.Clean(path)
 	base := filepath.Base(path)
 
 	for _, pattern := range blockedPatterns {
+		// Directory patterns (.git/, node_modules/) block the directory and
+		// everything beneath it
+		if strings.HasSuffix(pattern, "/") {
+			if inBlockedDir(path, strings.TrimSuffix(pattern, "/")) {
+				return pattern, true
+			}
+			continue
+		}
 		// Check against full path
 		if matched, _ := filepath.Match(pattern, path); matched {
-			return true
+			return pattern, true
 		}
 		// Check against basename
 		if matched, _ := filepath.Match(pattern, base); matched {
-			return true
+			return pattern, true
 		}
 		// Exact match or suffix match for non-glob patterns
 		if !strings.Contains(pattern, "*") {
 			if base == pattern || strings.HasSuffix(path, "/"+pattern) {
-				return true
+				return pattern, true
 			}
 		}
 	}
+	// A path that can't be stat'ed is left to the tool to report
+	if blockedSize > 0 {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Size() > blockedSize {
+			return blockedSizeRule, true
+		}
+	}
+	return "", false
+}
+
+// inBlockedDir reports whether any directory in path matches dir. A dir
+// with a slash, such as build/output, matches that sequence of directories.
+func inBlockedDir(path, dir string) bool {
+	path = filepath.ToSlash(path)
+	if strings.Contains(dir, "/") {
+		dir = strings.TrimPrefix(dir, "/")
+		return path == dir || strings.HasPrefix(path, dir+"/") ||
+			strings.HasSuffix(path, "/"+dir) || strings.Contains(path, "/"+dir+"/")
+	}
+	for _, part := range strings.Split(path, "/") {
+		if matched, _ := filepath.Match(dir, part); matched {
+			return true
+		}
+	}
 	return false
 }
 
+// BlockedDirs returns the directory names from directory-style patterns
+// (e.g. "node_modules/") that recursive searches should skip. Patterns
+// containing a path separator are left to IsPathBlocked. Default patterns
+// such as ".git/" are pruned even when pruneIgnoredDirs is off.
+func BlockedDirs() []string {
+	var dirs []string
+	for _, pattern := range blockedPatterns {
+		if !strings.HasSuffix(pattern, "/") {
+			continue
+		}
+		if !pruneIgnoredDirs && !slices.Contains(defaultBlockedPatterns, pattern) {
+			continue
+		}
+		name := strings.TrimSuffix(pattern, "/")
+		if name != "" && !strings.Contains(name, "/") {
+			dirs = append(dirs, name)
+		}
+	}
+	return dirs
+}
+
 // FilterBlockedPaths removes blocked paths from a list
 func FilterBlockedPaths(paths []string) []string {
 	var filtered []string
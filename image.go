@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Largest image -image will attach
+const maxImageBytes = 20 << 20
+
+// Image types accepted by OpenAI-compatible vision endpoints
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Model name fragments of models known to accept images
+var multimodalModels = []string{
+	"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-5", "o1", "o3", "o4",
+	"claude-3", "claude-sonnet", "claude-opus", "claude-haiku", "gemini",
+	"vision", "llava", "pixtral", "qwen-vl", "qwen2.5-vl", "minicpm-v",
+}
+
+// isMultimodal reports whether images can be sent to the configured model,
+// judged by its name unless the config sets vision
+func isMultimodal(cfg *Config) bool {
+	if cfg.Vision {
+		return true
+	}
+	model := strings.ToLower(cfg.Model)
+	for _, m := range multimodalModels {
+		if strings.Contains(model, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadImage reads a local image and returns it as a data URL
+func loadImage(path string) (string, error) {
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageBytes {
+		return "", fmt.Errorf("%s is too large to attach (%s, limit %s)", path, formatSize(info.Size()), formatSize(maxImageBytes))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	mediaType := http.DetectContentType(data)
+	if !imageTypes[mediaType] {
+		return "", fmt.Errorf("%s is not a PNG, JPEG, GIF, or WebP image", path)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// AttachImage adds a local image to the next question
+func (c *Client) AttachImage(path string) error {
+	if !isMultimodal(c.config) {
+		return fmt.Errorf("model %s does not accept images (set \"vision\": true in the config if it does)", c.config.Model)
+	}
+	url, err := loadImage(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images = append(c.images, url)
+	return nil
+}
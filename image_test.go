@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A 1x1 transparent PNG
+var testPNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49,
+	0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+func TestMessage_MarshalJSON_Image(t *testing.T) {
+	msg := Message{Role: "user", Content: "What does this diagram show?", Images: []string{"data:image/png;base64,iVBORw0KGgo="}}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	want := map[string]interface{}{
+		"role": "user",
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "What does this diagram show?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,iVBORw0KGgo="}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	// Messages without images keep string content
+	data, _ = json.Marshal(Message{Role: "user", Content: "hello"})
+	if string(data) != `{"role":"user","content":"hello"}` {
+		t.Errorf("json.Marshal() = %s, want string content", data)
+	}
+}
+
+func TestClient_AttachImage(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "diagram.png")
+	os.WriteFile(png, testPNG, 0644)
+	text := filepath.Join(dir, "notes.png")
+	os.WriteFile(text, []byte("not an image"), 0644)
+
+	client := NewClient(&Config{Model: "gpt-4o"})
+	if err := client.AttachImage(text); err == nil || !strings.Contains(err.Error(), "not a PNG") {
+		t.Errorf("AttachImage(text file) error = %v, want not an image", err)
+	}
+	if err := client.AttachImage(png); err != nil {
+		t.Fatalf("AttachImage() error = %v", err)
+	}
+	if len(client.images) != 1 || !strings.HasPrefix(client.images[0], "data:image/png;base64,") {
+		t.Errorf("images = %v, want a PNG data URL", client.images)
+	}
+
+	textOnly := NewClient(&Config{Model: "gpt-3.5-turbo"})
+	if err := textOnly.AttachImage(png); err == nil {
+		t.Error("AttachImage() should fail for a model that doesn't accept images")
+	}
+	textOnly.config.Vision = true
+	if err := textOnly.AttachImage(png); err != nil {
+		t.Errorf("AttachImage() with vision set error = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runInit asks for an API key, base URL, and model, checks them with ping,
+// and saves them to the config file at path. Other settings already in the
+// file are kept.
+func runInit(in io.Reader, out io.Writer, path string, ping func(*Config) error) error {
+	settings := make(map[string]interface{})
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("cannot update %s: %v", path, err)
+		}
+	}
+
+	cfg := &Config{BaseURL: "https://api.openai.com/v1", Model: "gpt-4o"}
+	if v, ok := settings["base_url"].(string); ok && v != "" {
+		cfg.BaseURL = v
+	}
+	if v, ok := settings["model"].(string); ok && v != "" {
+		cfg.Model = v
+	}
+	existingKey, _ := settings["api_key"].(string)
+
+	reader := bufio.NewReader(in)
+	ask := func(label, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", label)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("reading %s: %v", strings.ToLower(label), err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+		return def, nil
+	}
+
+	var err error
+	keyDefault := ""
+	if existingKey != "" {
+		keyDefault = "keep current"
+	}
+	if cfg.APIKey, err = ask("API key", keyDefault); err != nil {
+		return err
+	}
+	if cfg.APIKey == "keep current" {
+		cfg.APIKey = existingKey
+	}
+	if cfg.BaseURL, err = ask("Base URL", cfg.BaseURL); err != nil {
+		return err
+	}
+	if cfg.Model, err = ask("Model", cfg.Model); err != nil {
+		return err
+	}
+	cfg.Provider = DetectProvider(cfg.BaseURL)
+
+	if cfg.APIKey == "" {
+		return fmt.Errorf("an API key is required")
+	}
+
+	fmt.Fprintf(out, "Checking %s...\n", cfg.BaseURL)
+	if err := ping(cfg); err != nil {
+		fmt.Fprintf(out, "Check failed: %v\n", err)
+		answer, askErr := ask("Save anyway? (y/N)", "")
+		if askErr != nil || !strings.EqualFold(answer, "y") {
+			return fmt.Errorf("config not saved")
+		}
+	}
+
+	settings["base_url"] = cfg.BaseURL
+	settings["model"] = cfg.Model
+	settings["api_key"] = cfg.APIKey
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("cannot create %s: %v", filepath.Dir(path), err)
+	}
+	// The file holds the API key, so only the owner can read it
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Saved %s\n", path)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "codequery", "config.json")
+	input := strings.NewReader("sk-test\nhttps://openrouter.ai/api/v1\n\n")
+	var out bytes.Buffer
+	var pinged *Config
+
+	err := runInit(input, &out, path, func(cfg *Config) error {
+		pinged = cfg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runInit() error: %v\n%s", err, out.String())
+	}
+	if pinged == nil || pinged.APIKey != "sk-test" || pinged.Provider != "openrouter" {
+		t.Errorf("ping got %+v, want the entered settings", pinged)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("config permissions = %o, want 600", perm)
+	}
+	data, _ := os.ReadFile(path)
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("config is not valid JSON: %v\n%s", err, data)
+	}
+	want := map[string]string{"api_key": "sk-test", "base_url": "https://openrouter.ai/api/v1", "model": "gpt-4o"}
+	for k, v := range want {
+		if saved[k] != v {
+			t.Errorf("%s = %q, want %q", k, saved[k], v)
+		}
+	}
+}
+
+func TestRunInit_KeepsExistingSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"api_key": "sk-old", "model": "gpt-4o-mini", "color": false}`), 0600)
+
+	input := strings.NewReader("\n\nllama3.2\n")
+	if err := runInit(input, &bytes.Buffer{}, path, func(*Config) error { return nil }); err != nil {
+		t.Fatalf("runInit() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	var saved map[string]interface{}
+	json.Unmarshal(data, &saved)
+	if saved["api_key"] != "sk-old" || saved["model"] != "llama3.2" || saved["color"] != false {
+		t.Errorf("saved config = %v", saved)
+	}
+}
+
+func TestRunInit_PingFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	ping := func(*Config) error { return errors.New("connection refused") }
+
+	var out bytes.Buffer
+	err := runInit(strings.NewReader("sk-test\n\n\nn\n"), &out, path, ping)
+	if err == nil {
+		t.Fatal("runInit() should fail when the check fails and saving is declined")
+	}
+	if !strings.Contains(out.String(), "connection refused") {
+		t.Errorf("output should show the check error, got:\n%s", out.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("config should not be saved")
+	}
+
+	if err := runInit(strings.NewReader("sk-test\n\n\ny\n"), &bytes.Buffer{}, path, ping); err != nil {
+		t.Fatalf("runInit() error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("config should be saved when confirmed: %v", err)
+	}
+}
+
+func TestRunInit_RequiresKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := runInit(strings.NewReader("\n\n\n"), &bytes.Buffer{}, path, func(*Config) error { return nil })
+	if err == nil {
+		t.Fatal("runInit() should require an API key")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// languageNotes makes cat and head start with a comment naming the file's
+// language (language_notes)
+var languageNotes bool
+
+// language is how a file type is named and commented
+type language struct {
+	name    string
+	comment string // Comment syntax, with %s for the text
+}
+
+const (
+	slashComment = "// %s"
+	hashComment  = "# %s"
+	dashComment  = "-- %s"
+	blockComment = "/* %s */"
+	htmlComment  = "<!-- %s -->"
+)
+
+// Languages by file extension
+var languages = map[string]language{
+	".go":    {"Go source file", slashComment},
+	".py":    {"Python source file", hashComment},
+	".js":    {"JavaScript source file", slashComment},
+	".mjs":   {"JavaScript module", slashComment},
+	".jsx":   {"JavaScript (JSX) source file", slashComment},
+	".ts":    {"TypeScript source file", slashComment},
+	".tsx":   {"TypeScript (TSX) source file", slashComment},
+	".java":  {"Java source file", slashComment},
+	".kt":    {"Kotlin source file", slashComment},
+	".swift": {"Swift source file", slashComment},
+	".c":     {"C source file", slashComment},
+	".h":     {"C header file", slashComment},
+	".cpp":   {"C++ source file", slashComment},
+	".hpp":   {"C++ header file", slashComment},
+	".cs":    {"C# source file", slashComment},
+	".rs":    {"Rust source file", slashComment},
+	".php":   {"PHP source file", slashComment},
+	".scala": {"Scala source file", slashComment},
+	".rb":    {"Ruby source file", hashComment},
+	".sh":    {"Shell script", hashComment},
+	".bash":  {"Bash script", hashComment},
+	".pl":    {"Perl source file", hashComment},
+	".r":     {"R source file", hashComment},
+	".yaml":  {"YAML file", hashComment},
+	".yml":   {"YAML file", hashComment},
+	".toml":  {"TOML file", hashComment},
+	".sql":   {"SQL file", dashComment},
+	".lua":   {"Lua source file", dashComment},
+	".hs":    {"Haskell source file", dashComment},
+	".css":   {"CSS stylesheet", blockComment},
+	".scss":  {"SCSS stylesheet", slashComment},
+	".html":  {"HTML file", htmlComment},
+	".xml":   {"XML file", htmlComment},
+	".md":    {"Markdown file", htmlComment},
+}
+
+// languageNote returns a comment naming the language of path, such as
+// "// Go source file", or "" for unknown types and formats like JSON that
+// have no comments. A .gz suffix is ignored.
+func languageNote(path string) string {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	lang, ok := languages[ext]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(lang.comment, lang.name)
+}
+
+// addLanguageNote starts successful output with the language note for path
+// when language notes are on
+func addLanguageNote(path, output string, err error) (string, error) {
+	if !languageNotes || err != nil {
+		return output, err
+	}
+	// cat and head report a missing file in their output
+	if info, statErr := os.Stat(path); statErr != nil || info.IsDir() {
+		return output, err
+	}
+	if note := languageNote(path); note != "" {
+		output = note + "\n" + output
+	}
+	return output, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLanguageNote(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.go", "// Go source file"},
+		{"scripts/build.py", "# Python source file"},
+		{"web/app.js", "// JavaScript source file"},
+		{"schema.SQL", "-- SQL file"},
+		{"index.html", "<!-- HTML file -->"},
+		{"logs/server.go.gz", "// Go source file"},
+		{"package.json", ""},
+		{"Makefile", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := languageNote(tt.path); got != tt.want {
+				t.Errorf("languageNote(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteTool_LanguageNotes(t *testing.T) {
+	testFile := "test_language_note.py"
+	if err := os.WriteFile(testFile, []byte("print('hi')\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove(testFile)
+
+	if result, _ := ExecuteTool("cat", `{"path": "test_language_note.py"}`); result != "print('hi')\n" {
+		t.Errorf("cat with language notes off = %q, want the file unchanged", result)
+	}
+
+	languageNotes = true
+	defer func() { languageNotes = false }()
+	for _, tool := range []string{"cat", "head"} {
+		result, err := ExecuteTool(tool, `{"path": "test_language_note.py"}`)
+		if err != nil {
+			t.Fatalf("ExecuteTool %s error: %v", tool, err)
+		}
+		if want := "# Python source file\nprint('hi')\n"; result != want {
+			t.Errorf("%s with language notes = %q, want %q", tool, result, want)
+		}
+	}
+	if result, _ := ExecuteTool("cat", `{"path": "missing.py"}`); strings.HasPrefix(result, "#") {
+		t.Errorf("cat of a missing file = %q, want no language note", result)
+	}
+
+	// path and paths together: the path file is read first, noted once
+	result, err := ExecuteTool("cat", `{"path": "test_language_note.py", "paths": ["test_language_note.py"]}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool cat with paths error: %v", err)
+	}
+	if n := strings.Count(result, "# Python source file"); n != 1 {
+		t.Errorf("cat with path and paths has %d language notes, want 1:\n%s", n, result)
+	}
+	if !strings.HasPrefix(result, "===== test_language_note.py =====\n# Python source file\n") {
+		t.Errorf("cat with path and paths = %q, want the note under the file's header", result)
+	}
+}
@@ -1,21 +1,161 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/fatih/color"
 )
 
-var debugMode bool
+var (
+	debugMode     bool
+	debugJSON     bool
+	jsonMode      bool
+	query         string
+	explainAnswer bool
+	workDir       string
+	logFile       string
+	toolLogger    *ToolLogger
+	usePager      bool
+	checkOnly     bool
+	showVersion   bool
+	runSetup      bool
+	lenientMode   bool
+	wrapAnswers   bool
+	wrapWidth     int
+	systemAppend  string
+	cacheFile     string
+	answerStyle   string
+	autoSummarize bool
+	noHistory     bool
+	imagePath     string
+	seed          int
+	outputFile    string
+	quietMode     bool
+	readStdin     bool
+	templateName  string
+	templateArgs  = templateVars{}
+)
+
+// Process exit codes
+const (
+	exitOK          = 0
+	exitError       = 1 // The API request or a tool failed
+	exitConfigError = 2 // Invalid flags or configuration
+)
 
 func main() {
+	os.Exit(run())
+}
+
+// run parses flags and answers -query or starts the REPL, returning the
+// process exit code
+func run() int {
 	flag.BoolVar(&debugMode, "debug", false, "Enable debug output (show tool args and results)")
+	flag.BoolVar(&quietMode, "quiet", false, "Don't show the [tool] line for each tool call")
+	flag.BoolVar(&debugJSON, "debug-json", false, "Print each tool call as a line of JSON (name, args, result length, error)")
+	flag.BoolVar(&jsonMode, "json", false, "Answer -query once and print the result as JSON")
+	flag.StringVar(&query, "query", "", "Answer a single question and exit")
+	flag.StringVar(&templateName, "template", "", "Answer the named prompt template once and exit")
+	flag.Var(templateArgs, "var", "Set a template variable as key=value (repeatable)")
+	flag.StringVar(&outputFile, "output", "", "Write the -query answer to this file instead of stdout")
+	flag.BoolVar(&readStdin, "stdin", false, "Wait for stdin and add it as context for -query, even when it is slow to arrive")
+	flag.BoolVar(&explainAnswer, "explain-answer", false, "List the tool calls each answer was based on")
+	flag.StringVar(&workDir, "cwd", "", "Run against this directory instead of the current one")
+	flag.BoolVar(&noHistory, "no-history", false, "Don't read or save the REPL history file")
+	flag.StringVar(&cacheFile, "cache-file", "", "Reuse API responses to identical requests, saved to this file across sessions")
+	flag.BoolVar(&toolCacheEnabled, "cache", false, "Reuse results of identical read-only tool calls within the session")
+	flag.StringVar(&logFile, "log", "", "Append a line per tool call to this file")
+	flag.BoolVar(&readOnlyMode, "read-only", false, "Disable tools that write files")
+	flag.BoolVar(&redactOutput, "redact", false, "Replace API keys and tokens in tool output with ***REDACTED***")
+	flag.BoolVar(&allowSecrets, "allow-secrets", false, "Allow write_markdown to write content that looks like API keys")
+	flag.BoolVar(&autoSummarize, "auto-summarize", false, "Summarize very long tool output before sending it to the model")
+	flag.StringVar(&answerStyle, "style", "", "Answer style: concise or detailed")
+	flag.StringVar(&imagePath, "image", "", "Attach a PNG, JPEG, GIF, or WebP image to the first question")
+	flag.IntVar(&seed, "seed", 0, "Ask the provider for reproducible output with this sampling seed")
+	flag.StringVar(&systemAppend, "system-append", "", "Add instructions to the end of the system prompt")
+	flag.BoolVar(&wrapAnswers, "wrap", false, "Word-wrap answers to the terminal width")
+	flag.IntVar(&wrapWidth, "width", 0, "Word-wrap answers to this many columns (implies -wrap)")
+	flag.BoolVar(&lenientMode, "lenient", false, "Run tool calls that the model writes into its answer as JSON")
+	flag.BoolVar(&showVersion, "version", false, "Print the version and exit")
+	flag.BoolVar(&runSetup, "init", false, "Set up the API key, base URL, and model interactively")
+	flag.BoolVar(&checkOnly, "check", false, "Check that the endpoint is reachable and the model is available, then exit")
+	flag.StringVar(&configProfile, "profile", "", "Use the named profile from the config file")
+	flag.BoolVar(&usePager, "pager", false, "Show answers taller than the terminal in $PAGER (default less)")
 	flag.Parse()
 
+	if showVersion {
+		printVersion(os.Stdout)
+		return exitOK
+	}
+
+	if runSetup {
+		path := filepath.Join(getConfigDir(), "config.json")
+		ping := func(cfg *Config) error { return NewClient(cfg).Ping() }
+		if err := runInit(os.Stdin, os.Stdout, path, ping); err != nil {
+			PrintError(err.Error())
+			return exitConfigError
+		}
+		return exitOK
+	}
+
+	if templateName != "" && query != "" {
+		PrintError("-template and -query can't be combined")
+		return exitConfigError
+	}
+	if len(templateArgs) > 0 && templateName == "" {
+		PrintError("-var requires -template")
+		return exitConfigError
+	}
+
+	if outputFile != "" && ((query == "" && templateName == "") || jsonMode) {
+		PrintError("-output requires -query and can't be combined with -json")
+		return exitConfigError
+	}
+
+	if jsonMode {
+		if query == "" && templateName == "" {
+			PrintError("-json requires -query")
+			return exitConfigError
+		}
+		// Keep stdout clean for the JSON document
+		color.NoColor = true
+		color.Output = os.Stderr
+		debugMode = false
+		debugJSON = false
+	}
+
+	// Switch directories first so ignore files, project settings, and tool
+	// path validation all resolve against the target project
+	if workDir != "" {
+		if err := changeDirectory(workDir); err != nil {
+			PrintError(err.Error())
+			return exitConfigError
+		}
+	}
+
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			PrintError(fmt.Sprintf("Failed to open log file: %v", err))
+			return exitConfigError
+		}
+		defer f.Close()
+		toolLogger = NewToolLogger(f)
+	}
+
 	// Load ignore patterns
 	LoadIgnorePatterns()
 
@@ -23,39 +163,139 @@ func main() {
 	cfg, err := LoadConfig()
 	if err != nil {
 		PrintError(fmt.Sprintf("Failed to load config: %v", err))
-		os.Exit(1)
+		return exitConfigError
 	}
 
+	pruneIgnoredDirs = cfg.PruneIgnoredDirs
+	maxReadBytes = cfg.MaxReadBytes
+	fullOutputLimit = cfg.FullOutputLimit
+	detectEncoding = cfg.DetectEncoding
+	languageNotes = cfg.LanguageNotes
+	enabledToolNames = cfg.EnabledTools
+	disabledToolNames = cfg.DisabledTools
+	ConfigureColor(cfg.Color)
+
 	// Validate configuration
 	if cfg.APIKey == "" {
 		PrintError("No API key found. Set OPENAI_API_KEY environment variable or add to config file.")
+		fmt.Println("\nRun `codequery -init` to set one up.")
 		fmt.Println("\nConfig file location: ~/.config/codequery/config.json")
 		fmt.Println("Example config:")
 		fmt.Println(`  {"api_key": "sk-...", "model": "gpt-4o"}`)
-		os.Exit(1)
+		return exitConfigError
+	}
+
+	if lenientMode {
+		cfg.Lenient = true
+	}
+	if systemAppend != "" {
+		cfg.SystemAppend = systemAppend
+	}
+	if cacheFile != "" {
+		cfg.CacheFile = cacheFile
+	}
+	if autoSummarize {
+		cfg.AutoSummarize = true
+	}
+	if seed != 0 {
+		cfg.Seed = seed
+	}
+	if answerStyle != "" {
+		if _, ok := answerStyles[answerStyle]; !ok {
+			PrintError(fmt.Sprintf("unknown style %q (must be concise or detailed)", answerStyle))
+			return exitConfigError
+		}
+		cfg.Style = answerStyle
+	}
+
+	// A template becomes the single question
+	if templateName != "" {
+		tmpl, err := loadTemplate(cfg, templateName)
+		if err == nil {
+			query, err = RenderTemplate(tmpl, templateArgs)
+		}
+		if err != nil {
+			PrintError(err.Error())
+			return exitConfigError
+		}
 	}
 
 	// Create client
 	client := NewClient(cfg)
+	if imagePath != "" {
+		if err := client.AttachImage(imagePath); err != nil {
+			PrintError(fmt.Sprintf("Failed to attach image: %v", err))
+			return exitConfigError
+		}
+	}
+
+	// Piped input (e.g. `git diff | codequery -query "review this"`) becomes
+	// context for the single question; the REPL keeps reading stdin as before
+	if query != "" {
+		piped, err := readPipedInput(os.Stdin, readStdin)
+		if err != nil {
+			PrintError(fmt.Sprintf("Failed to read stdin: %v", err))
+			return exitError
+		}
+		if piped != "" {
+			client.AddContext(stdinContextMessage(piped))
+		}
+	}
+
+	if checkOnly {
+		return runCheck(client, cfg)
+	}
+	if jsonMode {
+		return runJSONQuery(client, query, os.Stdout)
+	}
+	if query != "" {
+		return runQuery(client, query, os.Stdout)
+	}
 
 	// Print welcome
-	PrintWelcome(cfg.Model, extractHost(cfg.BaseURL))
+	PrintWelcome(os.Stdout, cfg)
+
+	// A local server that isn't running otherwise only shows up as a
+	// connection error after the first question
+	if cfg.Provider == "ollama" {
+		if err := client.Ping(); err != nil {
+			PrintError(err.Error())
+			dimColor.Println("Is Ollama running? Start it with `ollama serve`.")
+			fmt.Println()
+		}
+	}
 
 	// Setup readline
+	historyFile := getHistoryFile(cfg)
+	if historyFile != "" {
+		if err := trimHistoryFile(historyFile, cfg.HistorySize); err != nil {
+			PrintError(fmt.Sprintf("Failed to trim history: %v", err))
+		}
+	}
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          "> ",
-		HistoryFile:     getHistoryFile(),
+		HistoryFile:     historyFile,
+		HistoryLimit:    cfg.HistorySize,
+		AutoComplete:    newCompleter(),
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
 	if err != nil {
 		PrintError(fmt.Sprintf("Failed to initialize readline: %v", err))
-		os.Exit(1)
+		return exitError
 	}
 	defer rl.Close()
 
 	spinner := NewSpinner()
 
+	// Say which tool is running when one takes a while
+	client.SetToolStart(func(name, argsJSON string) func() {
+		timer := time.AfterFunc(slowToolDelay, func() {
+			spinner.SetMessage(toolProgressMessage(name, argsJSON))
+		})
+		return func() { timer.Stop() }
+	})
+
 	// REPL loop
 	for {
 		line, err := rl.Readline()
@@ -76,6 +316,17 @@ func main() {
 			continue
 		}
 
+		// Ask the previous question again, e.g. after editing a file
+		if input == "!!" || input == "retry" {
+			last := client.LastQuestion()
+			if last == "" {
+				PrintError("no previous question to retry")
+				continue
+			}
+			dimColor.Printf("Retrying: %s\n", last)
+			input = last
+		}
+
 		// Handle special commands
 		if input == "exit" || input == "quit" {
 			fmt.Println("Goodbye!")
@@ -90,35 +341,455 @@ func main() {
 			printHelp()
 			continue
 		}
+		if input == "models" {
+			models, err := client.ListModels()
+			if err != nil {
+				PrintError(err.Error())
+				continue
+			}
+			PrintModels(models, cfg.Model)
+			continue
+		}
+		if input == "model" {
+			fmt.Printf("Current model: %s\n", cfg.Model)
+			continue
+		}
+		if strings.HasPrefix(input, "model ") {
+			model := strings.TrimSpace(strings.TrimPrefix(input, "model "))
+			client.SetModel(model)
+			fmt.Printf("Switched to %s. Conversation history kept.\n", model)
+			continue
+		}
+		if input == "stats" {
+			fmt.Println(FormatToolStats(client.ToolStats()))
+			continue
+		}
+		if input == "style" {
+			style := cfg.Style
+			if style == "" {
+				style = "default"
+			}
+			fmt.Printf("Current style: %s\n", style)
+			continue
+		}
+		if strings.HasPrefix(input, "style ") {
+			name := strings.TrimSpace(strings.TrimPrefix(input, "style "))
+			style := name
+			if style == "default" {
+				style = ""
+			}
+			if err := client.SetStyle(style); err != nil {
+				PrintError(err.Error())
+				continue
+			}
+			fmt.Printf("Answer style set to %s.\n", name)
+			continue
+		}
+		if strings.HasPrefix(input, "export ") {
+			path := strings.TrimSpace(strings.TrimPrefix(input, "export "))
+			if err := exportConversation(client, path); err != nil {
+				PrintError(err.Error())
+				continue
+			}
+			fmt.Printf("Conversation exported to %s.\n", path)
+			continue
+		}
+		if strings.HasPrefix(input, "force ") {
+			tool := strings.TrimSpace(strings.TrimPrefix(input, "force "))
+			if !HasTool(tool) {
+				PrintError(fmt.Sprintf("unknown tool: %s", tool))
+				continue
+			}
+			client.SetToolChoice(tool)
+			fmt.Printf("The next request will start with %s.\n", tool)
+			continue
+		}
+		if strings.HasPrefix(input, "check ") {
+			path := strings.TrimSpace(strings.TrimPrefix(input, "check "))
+			if pattern, blocked := MatchBlockedPattern(path); blocked {
+				fmt.Printf("%s is blocked by pattern %q\n", path, pattern)
+			} else {
+				fmt.Printf("%s is not blocked\n", path)
+			}
+			continue
+		}
 
 		// Send to LLM
 		if !debugMode {
 			spinner.Start("Thinking...")
 		}
 
-		response, err := client.Chat(input, func(name, argsJSON, result string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopInterrupt := cancelOnInterrupt(cancel)
+
+		start := time.Now()
+		response, err := client.Chat(ctx, input, logToolCalls(func(name, argsJSON, result string) {
 			spinner.Stop()
-			PrintTool(name, FormatToolCall(name, argsJSON))
-			if debugMode {
-				PrintDebugJSON("args", argsJSON)
-				PrintDebug("result", result)
-			}
+			showToolCall(os.Stdout, name, argsJSON, result)
 			if !debugMode {
 				spinner.Start("Thinking...")
 			}
-		})
+		}))
 
 		spinner.Stop()
+		stopInterrupt()
+		cancel()
 
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("Cancelled. The question was dropped from the conversation; type retry to ask it again.")
+			continue
+		}
 		if err != nil {
-			PrintError(err.Error())
+			if response != "" {
+				fmt.Println()
+				fmt.Println(response)
+				fmt.Println()
+			}
+			printChatError(err)
 			continue
 		}
 
 		fmt.Println()
-		fmt.Println(response)
+		response = wrapAnswer(response)
+		if usePager {
+			PageOutput(response)
+		} else {
+			fmt.Println(response)
+		}
 		fmt.Println()
+		PrintTiming(time.Since(start), client.LastUsage().CompletionTokens)
+
+		if explainAnswer {
+			PrintSources(TurnSources(client.LastTurn()))
+		}
 	}
+	return exitOK
+}
+
+// showToolCall prints a tool call in the REPL: a [tool] line unless -quiet,
+// followed by the arguments and result in debug mode, or one JSON line
+// with -debug-json
+func showToolCall(w io.Writer, name, argsJSON, result string) {
+	if debugJSON {
+		PrintDebugStructured(w, name, argsJSON, result)
+		return
+	}
+	if !quietMode {
+		PrintTool(w, name, FormatToolCall(name, argsJSON))
+	}
+	if debugMode {
+		printDebugResult(name, argsJSON, result)
+	}
+}
+
+// logToolCalls adds -log file logging to a tool callback when enabled
+func logToolCalls(cb ToolCallback) ToolCallback {
+	if toolLogger == nil {
+		return cb
+	}
+	return toolLogger.Wrap(cb)
+}
+
+// runQuery answers a single question, writes the answer to w, and returns
+// the process exit code. Tool calls are only shown in debug mode.
+func runQuery(client *Client, question string, w io.Writer) int {
+	response, err := client.Chat(context.Background(), question, logToolCalls(func(name, argsJSON, result string) {
+		if debugJSON {
+			PrintDebugStructured(os.Stderr, name, argsJSON, result)
+		} else if debugMode {
+			PrintTool(os.Stdout, name, FormatToolCall(name, argsJSON))
+			printDebugResult(name, argsJSON, result)
+		}
+	}))
+	if err != nil {
+		if response != "" {
+			fmt.Fprintln(w, response)
+		}
+		printChatError(err)
+		return exitError
+	}
+
+	if outputFile != "" {
+		if err := writeAnswerFile(outputFile, response); err != nil {
+			PrintError(fmt.Sprintf("Failed to write answer: %v", err))
+			return exitError
+		}
+		dimColor.Fprintf(os.Stderr, "Answer written to %s\n", outputFile)
+	} else {
+		fmt.Fprintln(w, wrapAnswer(response))
+	}
+	if explainAnswer {
+		PrintSources(TurnSources(client.LastTurn()))
+	}
+	return exitOK
+}
+
+// writeAnswerFile saves an answer for -output, creating parent directories.
+// The path comes from the user, so unlike write_markdown it may be anywhere
+// and may replace an existing file.
+func writeAnswerFile(path, answer string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(strings.TrimRight(answer, "\n")+"\n"), 0644)
+}
+
+// Piped input beyond this many bytes is dropped
+const maxStdinBytes = 1 << 20
+
+// How long a pipe on stdin may stay silent before it's taken to have no
+// input, without -stdin
+var stdinWait = time.Second
+
+// readPipedInput returns the contents of stdin when it is a non-empty file,
+// or a pipe that starts writing within stdinWait, and "" otherwise. Under
+// CI or cron stdin can be a pipe that never closes, so a plain -query must
+// not wait on it; force (-stdin) reads whatever stdin is until EOF.
+func readPipedInput(stdin *os.File, force bool) (string, error) {
+	info, err := stdin.Stat()
+	if err != nil {
+		return "", nil
+	}
+	var r io.Reader = stdin
+	switch mode := info.Mode(); {
+	case force:
+	case mode.IsRegular():
+		if info.Size() == 0 {
+			return "", nil
+		}
+	case mode&os.ModeNamedPipe != 0:
+		first, err := firstRead(stdin, stdinWait)
+		if err != nil || len(first) == 0 {
+			return "", err
+		}
+		r = io.MultiReader(bytes.NewReader(first), stdin)
+	default:
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxStdinBytes+1))
+	if err != nil {
+		return "", err
+	}
+	content := string(data)
+	if len(data) > maxStdinBytes {
+		content = content[:maxStdinBytes] + "\n... (truncated)"
+	}
+	return content, nil
+}
+
+// firstRead returns the first chunk read from f, or nothing when f hasn't
+// written anything within wait. The read is left running in that case; it
+// only matters for -query, which exits soon after.
+func firstRead(f *os.File, wait time.Duration) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		buf := make([]byte, 32*1024)
+		n, err := f.Read(buf)
+		if err == io.EOF {
+			err = nil
+		}
+		done <- result{buf[:n], err}
+	}()
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-time.After(wait):
+		return nil, nil
+	}
+}
+
+// stdinContextMessage wraps piped input as a user message placed before the question
+func stdinContextMessage(content string) Message {
+	content = strings.TrimRight(content, "\n")
+	return Message{
+		Role:    "user",
+		Content: "The following input was piped to CodeQuery on stdin. Use it as context for my next question:\n\n```\n" + content + "\n```",
+	}
+}
+
+// wrapAnswer applies -wrap/-width to an answer before it is printed
+func wrapAnswer(text string) string {
+	if wrapWidth > 0 {
+		return WrapText(text, wrapWidth)
+	}
+	if wrapAnswers {
+		return WrapText(text, terminalWidth())
+	}
+	return text
+}
+
+// printVersion writes the -version output
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "CodeQuery %s\n", Version)
+}
+
+// runCheck pings the endpoint for -check and returns the exit code
+func runCheck(client *Client, cfg *Config) int {
+	if err := client.Ping(); err != nil {
+		PrintError(err.Error())
+		return exitError
+	}
+	successColor.Printf("%s is reachable and %s is available\n", cfg.BaseURL, cfg.Model)
+	return exitOK
+}
+
+// printChatError reports a failed chat, with a hint for common API errors
+func printChatError(err error) {
+	PrintError(err.Error())
+
+	if errors.Is(err, ErrContextExceeded) {
+		dimColor.Println("Type `clear` to start a new conversation, or switch to a model with a larger context window.")
+		return
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		dimColor.Println("Check your API key (OPENAI_API_KEY or api_key in the config file).")
+	case http.StatusTooManyRequests:
+		dimColor.Println("Rate limited by the provider; wait a moment or set requests_per_minute in the config file.")
+	}
+}
+
+// printDebugResult shows a tool call's arguments and result in debug mode
+func printDebugResult(name, argsJSON, result string) {
+	PrintDebugJSON("args", argsJSON)
+	switch name {
+	case "ls":
+		PrintDebugLs(result)
+	case "tree":
+		PrintDebugTree(result)
+	default:
+		PrintDebug("result", result)
+	}
+}
+
+// jsonToolCall is a tool invocation reported in -json output
+type jsonToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Result    string          `json:"result"`
+}
+
+// jsonResult is the document printed in -json mode
+type jsonResult struct {
+	Answer    string         `json:"answer"`
+	ToolCalls []jsonToolCall `json:"tool_calls"`
+	Usage     Usage          `json:"usage"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// newJSONToolCall records a tool call, keeping valid argument JSON as an
+// object and quoting anything malformed as a string
+func newJSONToolCall(name, argsJSON, result string) jsonToolCall {
+	args := json.RawMessage(argsJSON)
+	if !json.Valid(args) {
+		args, _ = json.Marshal(argsJSON)
+	}
+	return jsonToolCall{Name: name, Arguments: args, Result: result}
+}
+
+// marshalJSONResult serializes a completed (or failed) turn for -json mode
+func marshalJSONResult(answer string, toolCalls []jsonToolCall, usage Usage, chatErr error) ([]byte, error) {
+	res := jsonResult{
+		Answer:    answer,
+		ToolCalls: toolCalls,
+		Usage:     usage,
+	}
+	if res.ToolCalls == nil {
+		res.ToolCalls = []jsonToolCall{}
+	}
+	if chatErr != nil {
+		res.Error = chatErr.Error()
+	}
+	return json.MarshalIndent(res, "", "  ")
+}
+
+// runJSONQuery answers a single question and writes the JSON result to w,
+// returning the process exit code
+func runJSONQuery(client *Client, question string, w io.Writer) int {
+	var toolCalls []jsonToolCall
+	answer, chatErr := client.Chat(context.Background(), question, logToolCalls(func(name, argsJSON, result string) {
+		toolCalls = append(toolCalls, newJSONToolCall(name, argsJSON, result))
+	}))
+
+	data, err := marshalJSONResult(answer, toolCalls, client.LastUsage(), chatErr)
+	if err != nil {
+		PrintError(fmt.Sprintf("Failed to encode result: %v", err))
+		return exitError
+	}
+	fmt.Fprintln(w, string(data))
+
+	if chatErr != nil {
+		return exitError
+	}
+	return exitOK
+}
+
+// exportConversation writes the transcript to a new markdown file
+func exportConversation(client *Client, path string) error {
+	if !strings.HasSuffix(strings.ToLower(path), ".md") {
+		return fmt.Errorf("export file must end with .md")
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("file already exists: %s", path)
+		}
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+	return client.ExportMarkdown(file)
+}
+
+// cancelOnInterrupt calls cancel when Ctrl-C is pressed while a request is
+// running (readline only handles it at the prompt). The returned function
+// stops listening.
+func cancelOnInterrupt(cancel context.CancelFunc) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, os.Interrupt)
+
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// changeDirectory makes dir the working directory after checking that it
+// exists and is a directory
+func changeDirectory(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory does not exist: %s", dir)
+		}
+		return fmt.Errorf("cannot access %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("failed to change directory to %s: %v", dir, err)
+	}
+	return nil
 }
 
 func extractHost(url string) string {
@@ -131,9 +802,42 @@ func extractHost(url string) string {
 	return url
 }
 
-func getHistoryFile() string {
+// How long a tool runs before the spinner names it
+const slowToolDelay = 2 * time.Second
+
+// Entries kept in the history file when history_size isn't set
+const defaultHistorySize = 1000
+
+// getHistoryFile returns the REPL history file from cfg, ~/.codequery_history
+// by default, or "" when history isn't saved
+func getHistoryFile(cfg *Config) string {
+	if noHistory {
+		return ""
+	}
 	home, _ := os.UserHomeDir()
-	return home + "/.codequery_history"
+	if cfg.HistoryFile == "" {
+		return filepath.Join(home, ".codequery_history")
+	}
+	if rest, ok := strings.CutPrefix(cfg.HistoryFile, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return cfg.HistoryFile
+}
+
+// trimHistoryFile drops the oldest entries so at most limit remain
+func trimHistoryFile(path string, limit int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if limit <= 0 || len(lines) <= limit {
+		return nil
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines[len(lines)-limit:], "\n")+"\n"), 0600)
 }
 
 func printHelp() {
@@ -142,14 +846,54 @@ Commands:
   exit, quit  - Exit the program
   clear, reset - Clear conversation history
   help        - Show this help message
+  models      - List models available from the provider
+  model <name> - Switch models, keeping the conversation
+  style <concise|detailed|default> - Change how long answers are
+  retry, !!   - Ask the previous question again
+  stats       - Show how often each tool was called and for how long
+  force <tool> - Make the model call <tool> on the next request
+  export <file.md> - Save the conversation as a markdown transcript
+  check <path> - Show whether <path> is blocked and by which pattern
 
 Flags:
-  -debug      - Show tool arguments and results
+  -debug      - Show tool arguments and results, and model thinking
+  -debug-json - Print each tool call as a line of JSON instead
+  -quiet      - Hide the [tool] lines and only show answers and errors
+  -json       - Answer -query once and print JSON (no color or spinner)
+  -query      - Answer a single question and exit
+  -template <name> - Answer a prompt template from the templates directory and exit
+  -var key=value - Fill in {key} in the template (repeatable)
+  -output <file> - Write the -query answer to <file> instead of stdout
+  -explain-answer - List the tool calls each answer was based on
+  -cwd <dir>  - Run against another directory instead of the current one
+  -cache      - Reuse results of identical read-only tool calls
+  -cache-file <file> - Reuse API responses to identical requests, saved across sessions
+  -no-history - Don't read or save the REPL history file
+  -log <file> - Append a line per tool call to <file>
+  -redact     - Hide API keys and tokens in tool output from the model
+  -allow-secrets - Allow write_markdown to write content that looks like API keys
+  -read-only  - Disable tools that write files
+  -pager      - Show long answers in $PAGER (default less)
+  -profile    - Use the named profile from the config file
+  -check      - Check the endpoint and model, then exit
+  -version    - Print the version and exit
+  -init       - Set up the API key, base URL, and model, then exit
+  -lenient    - Run tool calls the model writes into its answer as JSON
+  -wrap       - Word-wrap answers to the terminal width
+  -image <file> - Attach an image to the first question (multimodal models only)
+  -seed N     - Ask for reproducible output with sampling seed N
+  -system-append <text> - Add instructions to the end of the system prompt
+  -style <concise|detailed> - Ask for short or thorough answers
+  -auto-summarize - Summarize very long tool output before sending it to the model
+  -width N    - Word-wrap answers to N columns
 
 Environment variables:
   OPENAI_API_KEY    - Your API key (required)
   OPENAI_BASE_URL   - API endpoint (default: https://api.openai.com/v1)
   CODEQUERY_MODEL   - Model to use (default: gpt-4o)
+  CODEQUERY_PROVIDER - Provider (default: detected from base URL)
+  CODEQUERY_PROFILE - Config profile to use (overridden by -profile)
+  NO_COLOR          - Disable colored output
 
 Config file: ~/.config/codequery/config.json`)
 }
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalJSONResult(t *testing.T) {
+	calls := []jsonToolCall{
+		newJSONToolCall("cat", `{"path": "main.go"}`, "package main"),
+		newJSONToolCall("ls", `not json`, "error"),
+	}
+	usage := Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+
+	data, err := marshalJSONResult("The answer", calls, usage, nil)
+	if err != nil {
+		t.Fatalf("marshalJSONResult() error = %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, data)
+	}
+	if decoded["answer"] != "The answer" {
+		t.Errorf("answer = %v, want %q", decoded["answer"], "The answer")
+	}
+	if _, ok := decoded["error"]; ok {
+		t.Error("error should be omitted on success")
+	}
+
+	toolCalls := decoded["tool_calls"].([]interface{})
+	if len(toolCalls) != 2 {
+		t.Fatalf("tool_calls length = %d, want 2", len(toolCalls))
+	}
+	first := toolCalls[0].(map[string]interface{})
+	if args, ok := first["arguments"].(map[string]interface{}); !ok || args["path"] != "main.go" {
+		t.Errorf("valid arguments should be an object, got %v", first["arguments"])
+	}
+	second := toolCalls[1].(map[string]interface{})
+	if second["arguments"] != "not json" {
+		t.Errorf("invalid arguments should be a string, got %v", second["arguments"])
+	}
+
+	u := decoded["usage"].(map[string]interface{})
+	if u["total_tokens"] != 15.0 {
+		t.Errorf("usage.total_tokens = %v, want 15", u["total_tokens"])
+	}
+}
+
+func TestMarshalJSONResult_Error(t *testing.T) {
+	data, err := marshalJSONResult("", nil, Usage{}, errors.New("request failed"))
+	if err != nil {
+		t.Fatalf("marshalJSONResult() error = %v", err)
+	}
+
+	var decoded jsonResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if decoded.Error != "request failed" {
+		t.Errorf("Error = %q, want %q", decoded.Error, "request failed")
+	}
+	if !bytes.Contains(data, []byte(`"tool_calls": []`)) {
+		t.Errorf("tool_calls should be an empty array, got: %s", data)
+	}
+}
+
+func TestRunJSONQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "test-123",
+			"choices": [{"message": {"role": "assistant", "content": "Done"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 7, "completion_tokens": 3, "total_tokens": 10}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+
+	var out bytes.Buffer
+	if code := runJSONQuery(client, "hello", &out); code != 0 {
+		t.Fatalf("runJSONQuery() = %d, want 0", code)
+	}
+
+	var decoded jsonResult
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out.String())
+	}
+	if decoded.Answer != "Done" {
+		t.Errorf("Answer = %q, want %q", decoded.Answer, "Done")
+	}
+	if decoded.Usage.TotalTokens != 10 {
+		t.Errorf("Usage.TotalTokens = %d, want 10", decoded.Usage.TotalTokens)
+	}
+}
+
+func TestRunJSONQuery_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "server overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+
+	var out bytes.Buffer
+	if code := runJSONQuery(client, "hello", &out); code != exitError {
+		t.Errorf("runJSONQuery() = %d, want %d on API error", code, exitError)
+	}
+	var decoded jsonResult
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded.Error == "" {
+		t.Errorf("output = %s, want a JSON document with the error", out.String())
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if n := len(req.Messages); n != 2 || req.Messages[1].Content != "What is this?" {
+			t.Errorf("request should carry the system prompt and the question, got %d messages", n)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "A CLI tool"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+
+	var out bytes.Buffer
+	if code := runQuery(client, "What is this?", &out); code != 0 {
+		t.Fatalf("runQuery() = %d, want 0", code)
+	}
+	if out.String() != "A CLI tool\n" {
+		t.Errorf("runQuery() output = %q, want %q", out.String(), "A CLI tool\n")
+	}
+}
+
+func TestRunQuery_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "bad key"}}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+
+	var out bytes.Buffer
+	if code := runQuery(client, "What is this?", &out); code != exitError {
+		t.Errorf("runQuery() = %d, want %d on API error", code, exitError)
+	}
+	if out.Len() != 0 {
+		t.Errorf("runQuery() should not print an answer on error, got %q", out.String())
+	}
+}
+
+func TestWriteAnswerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docs", "api", "answer.md")
+
+	if err := writeAnswerFile(path, "# API\n\nThe client talks to the endpoint.\n\n"); err != nil {
+		t.Fatalf("writeAnswerFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("answer not written: %v", err)
+	}
+	if want := "# API\n\nThe client talks to the endpoint.\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+
+	// A later answer replaces the file
+	if err := writeAnswerFile(path, "Updated"); err != nil {
+		t.Fatalf("writeAnswerFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Updated\n" {
+		t.Errorf("file = %q, want the new answer", data)
+	}
+}
+
+func TestRunQuery_Output(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "A CLI tool"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "answer.md")
+	outputFile = path
+	defer func() { outputFile = "" }()
+
+	client := NewClient(&Config{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"})
+	var out bytes.Buffer
+	if code := runQuery(client, "What is this?", &out); code != exitOK {
+		t.Fatalf("runQuery() = %d, want %d", code, exitOK)
+	}
+	if out.Len() != 0 {
+		t.Errorf("stdout = %q, want the answer only in the file", out.String())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "A CLI tool\n" {
+		t.Errorf("file = %q, want the answer", data)
+	}
+}
+
+func TestShowToolCall_Quiet(t *testing.T) {
+	var buf bytes.Buffer
+	showToolCall(&buf, "cat", `{"path": "main.go"}`, "package main")
+	if !strings.Contains(buf.String(), "[tool] cat main.go") {
+		t.Errorf("showToolCall() = %q, want the [tool] line", buf.String())
+	}
+
+	quietMode = true
+	defer func() { quietMode = false }()
+	buf.Reset()
+	showToolCall(&buf, "cat", `{"path": "main.go"}`, "package main")
+	if buf.Len() != 0 {
+		t.Errorf("showToolCall() with -quiet = %q, want nothing", buf.String())
+	}
+}
+
+func TestStdinContextMessage(t *testing.T) {
+	msg := stdinContextMessage("diff --git a/main.go b/main.go\n+func added() {}\n")
+
+	if msg.Role != "user" {
+		t.Errorf("Role = %q, want user", msg.Role)
+	}
+	want := "```\ndiff --git a/main.go b/main.go\n+func added() {}\n```"
+	if !strings.HasSuffix(msg.Content, want) {
+		t.Errorf("Content = %q, want it to end with %q", msg.Content, want)
+	}
+	if !strings.Contains(msg.Content, "stdin") {
+		t.Errorf("Content = %q, want it to mention stdin", msg.Content)
+	}
+}
+
+func TestReadPipedInput(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer f.Close()
+	f.WriteString("piped content\n")
+	f.Seek(0, 0)
+
+	got, err := readPipedInput(f, false)
+	if err != nil {
+		t.Fatalf("readPipedInput() error = %v", err)
+	}
+	if got != "piped content\n" {
+		t.Errorf("readPipedInput() = %q, want %q", got, "piped content\n")
+	}
+
+	empty, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer empty.Close()
+	if got, err := readPipedInput(empty, false); got != "" || err != nil {
+		t.Errorf("readPipedInput(empty file) = %q, %v, want nothing", got, err)
+	}
+}
+
+func TestReadPipedInput_Pipe(t *testing.T) {
+	orig := stdinWait
+	stdinWait = 50 * time.Millisecond
+	defer func() { stdinWait = orig }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	go func() {
+		w.WriteString("git diff output\n")
+		w.Close()
+	}()
+	if got, err := readPipedInput(r, false); got != "git diff output\n" || err != nil {
+		t.Errorf("readPipedInput(pipe) = %q, %v, want the piped text", got, err)
+	}
+	r.Close()
+
+	// A pipe that stays open without writing, as under CI or cron, must not hang
+	silent, open, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer silent.Close()
+	defer open.Close()
+	started := time.Now()
+	if got, err := readPipedInput(silent, false); got != "" || err != nil {
+		t.Errorf("readPipedInput(silent pipe) = %q, %v, want nothing", got, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("readPipedInput(silent pipe) took %v, want it to give up after stdinWait", elapsed)
+	}
+
+	// -stdin waits for slow input
+	slowR, slowW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer slowR.Close()
+	go func() {
+		time.Sleep(2 * stdinWait)
+		slowW.WriteString("slow\n")
+		slowW.Close()
+	}()
+	if got, err := readPipedInput(slowR, true); got != "slow\n" || err != nil {
+		t.Errorf("readPipedInput(slow pipe, force) = %q, %v, want the piped text", got, err)
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	orig := Version
+	Version = "1.2.3"
+	defer func() { Version = orig }()
+
+	var buf bytes.Buffer
+	printVersion(&buf)
+	if buf.String() != "CodeQuery 1.2.3\n" {
+		t.Errorf("printVersion() = %q, want %q", buf.String(), "CodeQuery 1.2.3\n")
+	}
+}
+
+func TestChangeDirectory(t *testing.T) {
+	orig, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() error = %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(orig) })
+
+	dir := t.TempDir()
+	if err := changeDirectory(dir); err != nil {
+		t.Fatalf("changeDirectory(%q) error = %v", dir, err)
+	}
+	cwd, _ := os.Getwd()
+	want, _ := filepath.EvalSymlinks(dir)
+	if got, _ := filepath.EvalSymlinks(cwd); got != want {
+		t.Errorf("working directory = %q, want %q", got, want)
+	}
+}
+
+func TestChangeDirectory_Invalid(t *testing.T) {
+	orig, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(orig) })
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	os.WriteFile(file, []byte("x"), 0644)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing", filepath.Join(dir, "missing"), "does not exist"},
+		{"file", file, "not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := changeDirectory(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("changeDirectory(%q) = %v, want error containing %q", tt.path, err, tt.want)
+			}
+			if cwd, _ := os.Getwd(); cwd != orig {
+				t.Errorf("working directory changed to %q on error", cwd)
+			}
+		})
+	}
+}
+
+func TestGetHistoryFile(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"", filepath.Join(home, ".codequery_history")},
+		{"~/.codequery/history", filepath.Join(home, ".codequery", "history")},
+		{"/tmp/history", "/tmp/history"},
+	}
+	for _, tt := range tests {
+		if got := getHistoryFile(&Config{HistoryFile: tt.file}); got != tt.want {
+			t.Errorf("getHistoryFile(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	noHistory = true
+	defer func() { noHistory = false }()
+	if got := getHistoryFile(&Config{}); got != "" {
+		t.Errorf("getHistoryFile() with -no-history = %q, want empty", got)
+	}
+}
+
+func TestTrimHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("question %d", i))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	if err := trimHistoryFile(path, 3); err != nil {
+		t.Fatalf("trimHistoryFile() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "question 8\nquestion 9\nquestion 10\n"; string(data) != want {
+		t.Errorf("history = %q, want %q", data, want)
+	}
+
+	// Under the limit and missing files are left alone
+	if err := trimHistoryFile(path, 5); err != nil {
+		t.Fatalf("trimHistoryFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "question 8\nquestion 9\nquestion 10\n" {
+		t.Errorf("history under the limit changed to %q", data)
+	}
+	if err := trimHistoryFile(filepath.Join(t.TempDir(), "missing"), 3); err != nil {
+		t.Errorf("trimHistoryFile() on a missing file error = %v", err)
+	}
+}
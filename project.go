@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Manifests project_info looks for, in the order they're reported
+var projectManifests = []struct {
+	file     string
+	language string
+	parse    func(data []byte) ([]string, error)
+}{
+	{"go.mod", "Go", parseGoMod},
+	{"package.json", "JavaScript/TypeScript", parsePackageJSON},
+	{"Cargo.toml", "Rust", parseCargoToml},
+	{"pyproject.toml", "Python", parsePyproject},
+}
+
+// Dependencies in package.json whose versions are worth reporting
+var keyJSDependencies = []string{"typescript", "react", "vue", "svelte", "next", "express", "webpack", "vite", "jest"}
+
+func executeProjectInfo(ctx context.Context, args map[string]interface{}) (string, error) {
+	dir := getString(args, "path", ".")
+	if IsPathBlocked(dir) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", dir)
+	}
+
+	var sections []string
+	for _, m := range projectManifests {
+		path := filepath.Join(dir, m.file)
+		if IsPathBlocked(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fields, err := m.parse(data)
+		if err != nil {
+			sections = append(sections, fmt.Sprintf("%s (%s)\n  could not parse: %v", path, m.language, err))
+			continue
+		}
+		section := fmt.Sprintf("%s (%s)", path, m.language)
+		for _, field := range fields {
+			section += "\n  " + field
+		}
+		sections = append(sections, section)
+	}
+
+	if len(sections) == 0 {
+		return fmt.Sprintf("no go.mod, package.json, Cargo.toml, or pyproject.toml found in %s", dir), nil
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// parseGoMod reads the module path, Go version, toolchain, and number of
+// required modules from a go.mod
+func parseGoMod(data []byte) ([]string, error) {
+	var fields []string
+	requires, inRequire := 0, false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case line == "":
+		case inRequire:
+			if line == ")" {
+				inRequire = false
+			} else {
+				requires++
+			}
+		case line == "require (":
+			inRequire = true
+		case strings.HasPrefix(line, "require "):
+			requires++
+		case strings.HasPrefix(line, "module "):
+			fields = append(fields, "name: "+strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`))
+		case strings.HasPrefix(line, "go "):
+			fields = append(fields, "go: "+strings.TrimSpace(strings.TrimPrefix(line, "go")))
+		case strings.HasPrefix(line, "toolchain "):
+			fields = append(fields, "toolchain: "+strings.TrimSpace(strings.TrimPrefix(line, "toolchain")))
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no module declaration")
+	}
+	return append(fields, fmt.Sprintf("dependencies: %d", requires)), nil
+}
+
+// parsePackageJSON reads the name, version, engines, and the versions of
+// well-known frameworks and tools from a package.json
+func parsePackageJSON(data []byte) ([]string, error) {
+	var pkg struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Engines         map[string]string `json:"engines"`
+		PackageManager  string            `json:"packageManager"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if pkg.Name != "" {
+		fields = append(fields, "name: "+pkg.Name)
+	}
+	if pkg.Version != "" {
+		fields = append(fields, "version: "+pkg.Version)
+	}
+	engines := make([]string, 0, len(pkg.Engines))
+	for engine := range pkg.Engines {
+		engines = append(engines, engine)
+	}
+	sort.Strings(engines)
+	for _, engine := range engines {
+		fields = append(fields, fmt.Sprintf("%s: %s", engine, pkg.Engines[engine]))
+	}
+	if pkg.PackageManager != "" {
+		fields = append(fields, "package manager: "+pkg.PackageManager)
+	}
+	for _, dep := range keyJSDependencies {
+		if v, ok := pkg.Dependencies[dep]; ok {
+			fields = append(fields, fmt.Sprintf("%s: %s", dep, v))
+		} else if v, ok := pkg.DevDependencies[dep]; ok {
+			fields = append(fields, fmt.Sprintf("%s: %s (dev)", dep, v))
+		}
+	}
+	return append(fields, fmt.Sprintf("dependencies: %d, dev dependencies: %d", len(pkg.Dependencies), len(pkg.DevDependencies))), nil
+}
+
+// parseCargoToml reads the package name, version, edition, and minimum Rust
+// version from a Cargo.toml
+func parseCargoToml(data []byte) ([]string, error) {
+	var cargo struct {
+		Package struct {
+			Name        string `toml:"name"`
+			Version     string `toml:"version"`
+			Edition     string `toml:"edition"`
+			RustVersion string `toml:"rust-version"`
+		} `toml:"package"`
+		Dependencies map[string]interface{} `toml:"dependencies"`
+	}
+	if _, err := toml.Decode(string(data), &cargo); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for _, f := range []struct{ label, value string }{
+		{"name", cargo.Package.Name},
+		{"version", cargo.Package.Version},
+		{"edition", cargo.Package.Edition},
+		{"rust-version", cargo.Package.RustVersion},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.label+": "+f.value)
+		}
+	}
+	return append(fields, fmt.Sprintf("dependencies: %d", len(cargo.Dependencies))), nil
+}
+
+// parsePyproject reads the project name, version, and required Python
+// version from a pyproject.toml, using Poetry's table when [project] is absent
+func parsePyproject(data []byte) ([]string, error) {
+	var py struct {
+		Project struct {
+			Name           string   `toml:"name"`
+			Version        string   `toml:"version"`
+			RequiresPython string   `toml:"requires-python"`
+			Dependencies   []string `toml:"dependencies"`
+		} `toml:"project"`
+		Tool struct {
+			Poetry struct {
+				Name         string                 `toml:"name"`
+				Version      string                 `toml:"version"`
+				Dependencies map[string]interface{} `toml:"dependencies"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+		BuildSystem struct {
+			BuildBackend string `toml:"build-backend"`
+		} `toml:"build-system"`
+	}
+	if _, err := toml.Decode(string(data), &py); err != nil {
+		return nil, err
+	}
+
+	name, version := py.Project.Name, py.Project.Version
+	requiresPython := py.Project.RequiresPython
+	deps := len(py.Project.Dependencies)
+	if name == "" {
+		poetry := py.Tool.Poetry
+		name, version = poetry.Name, poetry.Version
+		if v, ok := poetry.Dependencies["python"].(string); ok {
+			requiresPython = v
+		}
+		deps = len(poetry.Dependencies)
+		if _, ok := poetry.Dependencies["python"]; ok {
+			deps--
+		}
+	}
+
+	var fields []string
+	for _, f := range []struct{ label, value string }{
+		{"name", name},
+		{"version", version},
+		{"python", requiresPython},
+		{"build backend", py.BuildSystem.BuildBackend},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.label+": "+f.value)
+		}
+	}
+	return append(fields, fmt.Sprintf("dependencies: %d", deps)), nil
+}
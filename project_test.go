@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProjectFixture creates a directory with a go.mod and a package.json
+func writeProjectFixture(t *testing.T) string {
+	t.Helper()
+	root := "test_project_fixture"
+	files := map[string]string{
+		"go.mod": `module example.com/widget
+
+go 1.22.3
+
+toolchain go1.22.5
+
+require (
+	github.com/fatih/color v1.16.0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+require github.com/BurntSushi/toml v1.3.2
+`,
+		"package.json": `{
+  "name": "widget-ui",
+  "version": "2.1.0",
+  "engines": {"node": ">=20"},
+  "dependencies": {"react": "^18.2.0", "lodash": "^4.17.21"},
+  "devDependencies": {"typescript": "~5.4.0"}
+}`,
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", root, err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	return root
+}
+
+func TestExecuteTool_ProjectInfo(t *testing.T) {
+	root := writeProjectFixture(t)
+
+	result, err := ExecuteTool("project_info", `{"path": "test_project_fixture"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool project_info error: %v", err)
+	}
+
+	for _, want := range []string{
+		filepath.Join(root, "go.mod") + " (Go)",
+		"name: example.com/widget",
+		"go: 1.22.3",
+		"toolchain: go1.22.5",
+		"dependencies: 3",
+		filepath.Join(root, "package.json") + " (JavaScript/TypeScript)",
+		"name: widget-ui",
+		"version: 2.1.0",
+		"node: >=20",
+		"react: ^18.2.0",
+		"typescript: ~5.4.0 (dev)",
+		"dependencies: 2, dev dependencies: 1",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("project_info output missing %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "lodash") {
+		t.Errorf("project_info should only list key dependencies, got:\n%s", result)
+	}
+}
+
+func TestExecuteTool_ProjectInfo_NoManifests(t *testing.T) {
+	if err := os.MkdirAll("test_project_empty", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll("test_project_empty")
+
+	result, err := ExecuteTool("project_info", `{"path": "test_project_empty"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool project_info error: %v", err)
+	}
+	if !strings.HasPrefix(result, "no go.mod") {
+		t.Errorf("project_info = %q, want a no-manifests message", result)
+	}
+}
+
+func TestExecuteTool_ProjectInfo_Blocked(t *testing.T) {
+	writeProjectFixture(t)
+	withIgnoreFile(t, "package.json\n")
+
+	result, err := ExecuteTool("project_info", `{"path": "test_project_fixture"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool project_info error: %v", err)
+	}
+	if strings.Contains(result, "widget-ui") || !strings.Contains(result, "example.com/widget") {
+		t.Errorf("project_info should skip blocked manifests, got:\n%s", result)
+	}
+}
+
+func TestParsePyproject(t *testing.T) {
+	fields, err := parsePyproject([]byte(`[project]
+name = "widget"
+version = "0.3.0"
+requires-python = ">=3.10"
+dependencies = ["requests>=2", "click"]
+`))
+	if err != nil {
+		t.Fatalf("parsePyproject() error: %v", err)
+	}
+	got := strings.Join(fields, "\n")
+	want := "name: widget\nversion: 0.3.0\npython: >=3.10\ndependencies: 2"
+	if got != want {
+		t.Errorf("parsePyproject() = %q, want %q", got, want)
+	}
+}
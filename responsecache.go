@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// How long cached responses are reused when response_cache_ttl isn't set
+const defaultResponseCacheTTL = 24 * time.Hour
+
+// responseCache stores API responses keyed on a hash of the request, so an
+// identical request (same model, messages, and tools) skips the API. With a
+// path, entries are persisted across sessions.
+type responseCache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]responseCacheEntry
+}
+
+type responseCacheEntry struct {
+	Response json.RawMessage `json:"response"`
+	Stored   time.Time       `json:"stored"`
+}
+
+// newResponseCache creates a cache, loading unexpired entries from path
+// when it exists. A missing or unreadable file starts an empty cache.
+func newResponseCache(path string, ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		ttl = defaultResponseCacheTTL
+	}
+	rc := &responseCache{path: path, ttl: ttl, entries: make(map[string]responseCacheEntry)}
+	if path == "" {
+		return rc
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rc
+	}
+	var entries map[string]responseCacheEntry
+	if json.Unmarshal(data, &entries) != nil {
+		return rc
+	}
+	for key, entry := range entries {
+		if time.Since(entry.Stored) < ttl {
+			rc.entries[key] = entry
+		}
+	}
+	return rc
+}
+
+// responseCacheKey hashes a marshaled request body
+func responseCacheKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached response for key if it hasn't expired
+func (rc *responseCache) get(key string) ([]byte, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	entry, ok := rc.entries[key]
+	if !ok || time.Since(entry.Stored) >= rc.ttl {
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+// put stores a response and writes the cache file when there is one
+func (rc *responseCache) put(key string, response []byte) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[key] = responseCacheEntry{Response: json.RawMessage(response), Stored: time.Now()}
+	if rc.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(rc.entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(rc.path, data, 0600)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolStats counts tool calls and their cumulative run time for the session
+type ToolStats struct {
+	mu    sync.Mutex
+	tools map[string]*ToolStat
+}
+
+// ToolStat is the usage of one tool
+type ToolStat struct {
+	Name     string
+	Calls    int
+	Duration time.Duration
+}
+
+// Record adds one call of name that took d
+func (s *ToolStats) Record(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tools == nil {
+		s.tools = make(map[string]*ToolStat)
+	}
+	stat, ok := s.tools[name]
+	if !ok {
+		stat = &ToolStat{Name: name}
+		s.tools[name] = stat
+	}
+	stat.Calls++
+	stat.Duration += d
+}
+
+// Summary returns the recorded tools, most called first
+func (s *ToolStats) Summary() []ToolStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]ToolStat, 0, len(s.tools))
+	for _, stat := range s.tools {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Calls != stats[j].Calls {
+			return stats[i].Calls > stats[j].Calls
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// FormatToolStats renders a summary as a table of tool, calls, and total time
+func FormatToolStats(stats []ToolStat) string {
+	if len(stats) == 0 {
+		return "No tools have been called yet."
+	}
+	width := len("Tool")
+	for _, stat := range stats {
+		width = max(width, len(stat.Name))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s  %5s  %s\n", width, "Tool", "Calls", "Time")
+	for _, stat := range stats {
+		fmt.Fprintf(&b, "%-*s  %5d  %s\n", width, stat.Name, stat.Calls, stat.Duration.Round(time.Millisecond))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
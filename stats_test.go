@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToolStats_Summary(t *testing.T) {
+	var stats ToolStats
+	stats.Record("cat", 20*time.Millisecond)
+	stats.Record("grep", 1500*time.Millisecond)
+	stats.Record("cat", 30*time.Millisecond)
+	stats.Record("tree", 10*time.Millisecond)
+	stats.Record("grep", 500*time.Millisecond)
+	stats.Record("cat", 50*time.Millisecond)
+
+	want := []ToolStat{
+		{"cat", 3, 100 * time.Millisecond},
+		{"grep", 2, 2 * time.Second},
+		{"tree", 1, 10 * time.Millisecond},
+	}
+	got := stats.Summary()
+	if len(got) != len(want) {
+		t.Fatalf("Summary() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Summary()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	table := FormatToolStats(got)
+	wantTable := "Tool  Calls  Time\n" +
+		"cat       3  100ms\n" +
+		"grep      2  2s\n" +
+		"tree      1  10ms"
+	if table != wantTable {
+		t.Errorf("FormatToolStats() =\n%s\nwant\n%s", table, wantTable)
+	}
+}
+
+func TestFormatToolStats_Empty(t *testing.T) {
+	var stats ToolStats
+	if got := FormatToolStats(stats.Summary()); got != "No tools have been called yet." {
+		t.Errorf("FormatToolStats() = %q", got)
+	}
+}
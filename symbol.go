@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Symbol names read_symbol accepts; anything else could inject into the regexp
+var symbolNamePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+const (
+	maxSymbolMatches  = 5       // Definitions returned per call
+	maxSymbolLines    = 300     // Lines returned per definition
+	maxSymbolFileSize = 1 << 20 // Larger files are skipped
+)
+
+// definitionPattern matches a line that likely defines name in Go, Python,
+// JavaScript/TypeScript, Ruby, Rust, Java, C#, and similar languages
+func definitionPattern(name string) *regexp.Regexp {
+	modifiers := `(?:(?:export|default|public|private|protected|internal|static|async|abstract|final|pub(?:\([a-z]+\))?|unsafe|override|virtual)\s+)*`
+	keywords := `(?:func|def|class|function|fn|type|struct|interface|enum|trait|module|impl)`
+	receiver := `(?:\([^)]*\)\s*)?` // Go method receiver
+	return regexp.MustCompile(`^\s*` + modifiers + keywords + `\s+` + receiver + regexp.QuoteMeta(name) + `\b`)
+}
+
+// symbolBlock returns the first and last line indexes of the definition
+// starting at lines[start]. Brace languages end at the matching close brace;
+// otherwise the block is the following lines indented deeper than the first.
+func symbolBlock(lines []string, start int) (int, int) {
+	// Include doc comments directly above the definition
+	first := start
+	for first > 0 {
+		prev := strings.TrimSpace(lines[first-1])
+		if !strings.HasPrefix(prev, "//") && !strings.HasPrefix(prev, "#") && !strings.HasPrefix(prev, "*") && !strings.HasPrefix(prev, "/*") {
+			break
+		}
+		first--
+	}
+
+	// Brace-delimited: count braces until they balance
+	depth, opened := 0, false
+	for i := start; i < len(lines) && i < start+maxSymbolLines; i++ {
+		if !opened && (i > start+2 || strings.HasSuffix(strings.TrimSpace(lines[i]), ":")) {
+			break // No brace near the definition, e.g. Python's "def name():"
+		}
+		for _, r := range lines[i] {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return first, i
+		}
+	}
+
+	// Indentation-delimited
+	indent := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+	last := start
+	for i := start + 1; i < len(lines) && i < start+maxSymbolLines; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		if len(lines[i])-len(strings.TrimLeft(lines[i], " \t")) <= indent {
+			// Ruby and similar close the block with "end" at the same indent
+			if trimmed == "end" {
+				last = i
+			}
+			break
+		}
+		last = i
+	}
+	return first, last
+}
+
+func executeReadSymbol(ctx context.Context, args map[string]interface{}) (string, error) {
+	name := getString(args, "name", "")
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if !symbolNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid symbol name: %s (use a plain identifier)", name)
+	}
+	root := getString(args, "path", ".")
+	if IsPathBlocked(root) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", root)
+	}
+
+	re := definitionPattern(name)
+	pruned := make(map[string]bool)
+	for _, dir := range BlockedDirs() {
+		pruned[dir] = true
+	}
+
+	var results []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("symbol search timed out")
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || skippedImportDirs[name] || pruned[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || IsPathBlocked(path) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxSymbolFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil // Unreadable or binary
+		}
+
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			first, last := symbolBlock(lines, i)
+			results = append(results, fmt.Sprintf("%s:%d-%d\n%s", path, first+1, last+1, strings.Join(lines[first:last+1], "\n")))
+			if len(results) >= maxSymbolMatches {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("no definition of %s found in %s", name, root), nil
+	}
+	// A generated definition can be huge even within maxSymbolLines
+	return truncateOutput(strings.Join(results, "\n\n")), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSymbolFixture creates source files with definitions to extract
+func writeSymbolFixture(t *testing.T) string {
+	t.Helper()
+	root := "test_symbol_fixture"
+	files := map[string]string{
+		"config.go": `package fixture
+
+// LoadSettings reads settings from disk
+func LoadSettings(path string) (*Settings, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return &Settings{}, nil
+}
+
+func (s *Settings) Reload() error {
+	return nil
+}
+
+type Settings struct {
+	Name string
+}
+`,
+		"tool.py": `import os
+
+def parse_args(argv):
+    if not argv:
+        return []
+
+    return argv[1:]
+
+def main():
+    pass
+`,
+		"private.key": "func LoadSettings() {}\n",
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("Failed to create fixture dir: %v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write fixture file: %v", err)
+		}
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	return root
+}
+
+func TestExecuteTool_ReadSymbol_GoFunction(t *testing.T) {
+	root := writeSymbolFixture(t)
+
+	result, err := ExecuteTool("read_symbol", `{"name": "LoadSettings", "path": "test_symbol_fixture"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool read_symbol error: %v", err)
+	}
+	want := filepath.Join(root, "config.go") + `:3-9
+// LoadSettings reads settings from disk
+func LoadSettings(path string) (*Settings, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return &Settings{}, nil
+}`
+	if result != want {
+		t.Errorf("read_symbol LoadSettings =\n%s\nwant\n%s", result, want)
+	}
+}
+
+func TestExecuteTool_ReadSymbol_Variants(t *testing.T) {
+	writeSymbolFixture(t)
+
+	tests := []struct {
+		name      string
+		wantFirst string
+		wantLast  string
+	}{
+		{"Reload", "func (s *Settings) Reload() error {", "}"},
+		{"Settings", "type Settings struct {", "}"},
+		{"parse_args", "def parse_args(argv):", "    return argv[1:]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteTool("read_symbol", `{"name": "`+tt.name+`", "path": "test_symbol_fixture"}`)
+			if err != nil {
+				t.Fatalf("ExecuteTool read_symbol error: %v", err)
+			}
+			lines := strings.Split(result, "\n")
+			if len(lines) < 3 || lines[1] != tt.wantFirst || lines[len(lines)-1] != tt.wantLast {
+				t.Errorf("read_symbol %s =\n%s\nwant block from %q to %q", tt.name, result, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestExecuteTool_ReadSymbol_Truncated(t *testing.T) {
+	root := writeSymbolFixture(t)
+	generated := "package fixture\n\nfunc Table() []string {\n\treturn []string{\n" + strings.Repeat("\t\t\""+strings.Repeat("x", 250)+"\",\n", 250) + "\t}\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "table.go"), []byte(generated), 0644); err != nil {
+		t.Fatalf("Failed to write fixture file: %v", err)
+	}
+
+	result, err := ExecuteTool("read_symbol", `{"name": "Table", "path": "test_symbol_fixture"}`)
+	if err != nil {
+		t.Fatalf("ExecuteTool read_symbol error: %v", err)
+	}
+	if !strings.HasSuffix(result, truncationNotice) || len(result) != maxOutputLen+len(truncationNotice) {
+		t.Errorf("read_symbol of a huge definition returned %d bytes, want it cut at %d", len(result), maxOutputLen)
+	}
+}
+
+func TestExecuteTool_ReadSymbol_NotFoundAndInvalid(t *testing.T) {
+	writeSymbolFixture(t)
+
+	result, err := ExecuteTool("read_symbol", `{"name": "Missing", "path": "test_symbol_fixture"}`)
+	if err != nil || !strings.Contains(result, "no definition of Missing") {
+		t.Errorf("read_symbol Missing = %q, %v, want not found message", result, err)
+	}
+
+	if _, err := ExecuteTool("read_symbol", `{"name": "a.*b"}`); err == nil {
+		t.Error("read_symbol should reject names that aren't identifiers")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Placeholders are {name}; braces around anything else, such as JSON in a
+// template, are left alone
+var templatePlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_-]*)\}`)
+
+// Extensions tried when a template is named without one
+var templateExtensions = []string{"", ".md", ".txt"}
+
+// templateVars collects repeated -var key=value flags
+type templateVars map[string]string
+
+func (v templateVars) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v templateVars) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	v[key] = value
+	return nil
+}
+
+// RenderTemplate replaces each {name} placeholder in tmpl with vars[name].
+// Every placeholder must have a value; the error lists the missing ones.
+func RenderTemplate(tmpl string, vars map[string]string) (string, error) {
+	var missing []string
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := vars[match[1]]; !ok && !slices.Contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("missing template variables: %s (set them with -var name=value)", strings.Join(missing, ", "))
+	}
+	return templatePlaceholder.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		return vars[strings.Trim(placeholder, "{}")]
+	}), nil
+}
+
+// templateDirs returns the directories searched for templates: the
+// project's (cfg.TemplatesDir) first, then ~/.config/codequery/templates
+func templateDirs(cfg *Config) []string {
+	var dirs []string
+	if cfg.TemplatesDir != "" {
+		dirs = append(dirs, cfg.TemplatesDir)
+	}
+	return append(dirs, filepath.Join(getConfigDir(), "templates"))
+}
+
+// loadTemplate reads the named template, with or without its .md or .txt
+// extension, from the first template directory that has it
+func loadTemplate(cfg *Config, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid template name %q", name)
+	}
+	dirs := templateDirs(cfg)
+	for _, dir := range dirs {
+		for _, ext := range templateExtensions {
+			data, err := os.ReadFile(filepath.Join(dir, name+ext))
+			if err == nil {
+				return strings.TrimSpace(string(data)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("template %q not found in %s", name, strings.Join(dirs, " or "))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{"single", "Explain the purpose of {file}", map[string]string{"file": "client.go"}, "Explain the purpose of client.go"},
+		{"repeated", "{file} imports what? Who imports {file}?", map[string]string{"file": "ui.go"}, "ui.go imports what? Who imports ui.go?"},
+		{"several", "Compare {old_name} with {new-name}", map[string]string{"old_name": "a.go", "new-name": "b.go"}, "Compare a.go with b.go"},
+		{"unused vars", "No placeholders", map[string]string{"file": "x"}, "No placeholders"},
+		{"other braces", `Return {"file": {file}} and {} as is`, map[string]string{"file": "1"}, `Return {"file": 1} and {} as is`},
+		{"empty value", "[{file}]", map[string]string{"file": ""}, "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderTemplate(tt.tmpl, tt.vars)
+			if err != nil {
+				t.Fatalf("RenderTemplate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate_MissingVariables(t *testing.T) {
+	_, err := RenderTemplate("Explain {file} in {package}, then {file} again", map[string]string{"other": "x"})
+	if err == nil {
+		t.Fatal("RenderTemplate() with missing variables should return an error")
+	}
+	if !strings.Contains(err.Error(), "missing template variables: file, package") {
+		t.Errorf("RenderTemplate() error = %v, want each missing variable listed once", err)
+	}
+}
+
+func TestTemplateVars_Set(t *testing.T) {
+	vars := templateVars{}
+	for _, arg := range []string{"file=client.go", "query=a=b", "empty="} {
+		if err := vars.Set(arg); err != nil {
+			t.Errorf("Set(%q) error = %v", arg, err)
+		}
+	}
+	if vars["file"] != "client.go" || vars["query"] != "a=b" || vars["empty"] != "" {
+		t.Errorf("vars = %v, want file, query, and empty set", vars)
+	}
+	for _, arg := range []string{"novalue", "=value"} {
+		if err := vars.Set(arg); err == nil {
+			t.Errorf("Set(%q) should return an error", arg)
+		}
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	userDir := filepath.Join(xdg, "codequery", "templates")
+	projectTemplates := t.TempDir()
+	os.MkdirAll(userDir, 0755)
+	os.WriteFile(filepath.Join(userDir, "explain.md"), []byte("User explain {file}\n"), 0644)
+	os.WriteFile(filepath.Join(userDir, "review.txt"), []byte("Review {file}"), 0644)
+	os.WriteFile(filepath.Join(projectTemplates, "explain.md"), []byte("Project explain {file}\n"), 0644)
+
+	cfg := &Config{}
+	if got, err := loadTemplate(cfg, "explain"); err != nil || got != "User explain {file}" {
+		t.Errorf("loadTemplate(explain) = %q, %v, want the user template", got, err)
+	}
+	if got, err := loadTemplate(cfg, "review.txt"); err != nil || got != "Review {file}" {
+		t.Errorf("loadTemplate(review.txt) = %q, %v, want the template by its full name", got, err)
+	}
+
+	cfg.TemplatesDir = projectTemplates
+	if got, err := loadTemplate(cfg, "explain"); err != nil || got != "Project explain {file}" {
+		t.Errorf("loadTemplate(explain) = %q, %v, want the project template to win", got, err)
+	}
+	if got, err := loadTemplate(cfg, "review"); err != nil || got != "Review {file}" {
+		t.Errorf("loadTemplate(review) = %q, %v, want the user template as a fallback", got, err)
+	}
+
+	if _, err := loadTemplate(cfg, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("loadTemplate(missing) error = %v, want not found", err)
+	}
+	if _, err := loadTemplate(cfg, "../explain"); err == nil || !strings.Contains(err.Error(), "invalid template name") {
+		t.Errorf("loadTemplate(../explain) error = %v, want invalid template name", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum result length kept in a log line
+const toolLogResultLimit = 200
+
+// ToolLogger appends one timestamped line per tool execution to a writer
+type ToolLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewToolLogger creates a logger writing to w
+func NewToolLogger(w io.Writer) *ToolLogger {
+	return &ToolLogger{w: w, now: time.Now}
+}
+
+// Log records a tool call. Results starting with "Error: " (as produced by
+// Client.Chat for failed tools) are logged as errors.
+func (l *ToolLogger) Log(name, argsJSON, result string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line := fmt.Sprintf("%s tool=%s args=%s", l.now().Format(time.RFC3339), name, strings.TrimSpace(argsJSON))
+	if msg, ok := strings.CutPrefix(result, "Error: "); ok {
+		line += fmt.Sprintf(" error=%q", msg)
+	} else {
+		if len(result) > toolLogResultLimit {
+			result = result[:toolLogResultLimit] + "... (truncated)"
+		}
+		line += fmt.Sprintf(" result=%q", result)
+	}
+	fmt.Fprintln(l.w, line)
+}
+
+// Wrap returns a callback that logs each tool call before passing it on to next
+func (l *ToolLogger) Wrap(next ToolCallback) ToolCallback {
+	return func(name, argsJSON, result string) {
+		l.Log(name, argsJSON, result)
+		if next != nil {
+			next(name, argsJSON, result)
+		}
+	}
+}
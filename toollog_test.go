@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestToolLogger(buf *bytes.Buffer) *ToolLogger {
+	logger := NewToolLogger(buf)
+	logger.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return logger
+}
+
+func TestToolLogger_Log(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestToolLogger(&buf)
+
+	logger.Log("cat", `{"path": "main.go"}`, "package main\n")
+
+	expected := `2024-05-01T12:00:00Z tool=cat args={"path": "main.go"} result="package main\n"` + "\n"
+	if buf.String() != expected {
+		t.Errorf("log line = %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestToolLogger_LogError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestToolLogger(&buf)
+
+	logger.Log("cat", `{"path": ".env"}`, "Error: access denied: .env is in ignore list")
+
+	if !strings.Contains(buf.String(), `error="access denied: .env is in ignore list"`) {
+		t.Errorf("log line should record the error, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "result=") {
+		t.Errorf("failed call should not log a result, got %q", buf.String())
+	}
+}
+
+func TestToolLogger_TruncatesResult(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestToolLogger(&buf)
+
+	logger.Log("cat", `{}`, strings.Repeat("x", 1000))
+
+	if len(buf.String()) > 300 || !strings.Contains(buf.String(), "(truncated)") {
+		t.Errorf("long result should be truncated, got %d bytes", len(buf.String()))
+	}
+}
+
+func TestToolLogger_Wrap(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestToolLogger(&buf)
+
+	called := false
+	cb := logger.Wrap(func(name, argsJSON, result string) { called = true })
+	cb("ls", `{}`, "main.go")
+	cb("ls", `{}`, "main.go")
+
+	if !called {
+		t.Error("wrapped callback was not called")
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("log has %d lines, want 2", n)
+	}
+}
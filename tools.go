@@ -1,12 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -34,7 +50,7 @@ var ToolDefinitions = []map[string]interface{}{
 		"type": "function",
 		"function": map[string]interface{}{
 			"name":        "cat",
-			"description": "Read and display the entire contents of a file.",
+			"description": "Read and display the entire contents of a file, or of several files at once with paths. Files ending in .gz are decompressed.",
 			"parameters": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -42,8 +58,25 @@ var ToolDefinitions = []map[string]interface{}{
 						"type":        "string",
 						"description": "Path to the file to read",
 					},
+					"paths": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Several files to read in one call instead of path; each is shown under a ===== path ===== line",
+					},
+					"pretty": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Re-indent .json files so minified JSON is readable (default: false)",
+					},
+					"number": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Prefix each line with its line number (default: false)",
+					},
+					"full": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Raise the output limit when the whole file is needed and the normal limit would truncate it (default: false)",
+					},
 				},
-				"required": []string{"path"},
+				"required": []string{},
 			},
 		},
 	},
@@ -51,7 +84,32 @@ var ToolDefinitions = []map[string]interface{}{
 		"type": "function",
 		"function": map[string]interface{}{
 			"name":        "head",
-			"description": "Read the first N lines of a file. Useful for previewing large files.",
+			"description": "Read the first N lines of a file. Useful for previewing large files. Files ending in .gz are decompressed.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the file to read",
+					},
+					"lines": map[string]interface{}{
+						"type":        "integer",
+						"description": "Number of lines to read (default: 50)",
+					},
+					"number": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Prefix each line with its line number (default: false)",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "tail",
+			"description": "Read the last N lines of a file. Useful for recent entries in logs and other append-only files.",
 			"parameters": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -68,6 +126,31 @@ var ToolDefinitions = []map[string]interface{}{
 			},
 		},
 	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "read_chunk",
+			"description": "Read a large file in fixed-size chunks of lines. Returns the requested chunk and how many chunks the file has, so you can page through files too big for cat.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the file to read",
+					},
+					"chunk": map[string]interface{}{
+						"type":        "integer",
+						"description": "Zero-based chunk index (default: 0)",
+					},
+					"chunk_size": map[string]interface{}{
+						"type":        "integer",
+						"description": "Lines per chunk (default: 500)",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
 	{
 		"type": "function",
 		"function": map[string]interface{}{
@@ -88,11 +171,48 @@ var ToolDefinitions = []map[string]interface{}{
 						"type":        "boolean",
 						"description": "Search recursively in subdirectories (default: true)",
 					},
+					"max_matches": map[string]interface{}{
+						"type":        "integer",
+						"description": "Stop after this many matching lines per file (default: unlimited)",
+					},
+					"context": map[string]interface{}{
+						"type":        "integer",
+						"description": "Lines of context to show around each match (default: 0)",
+					},
+					"full": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Raise the output limit when every match is needed and the normal limit would truncate them (default: false)",
+					},
 				},
 				"required": []string{"pattern"},
 			},
 		},
 	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "grep_context",
+			"description": "Show the first match of a pattern in one file with the lines around it, numbered. Use this instead of grep followed by read_chunk when you want the code around a match.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "File to search",
+					},
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "Regular expression to search for",
+					},
+					"context": map[string]interface{}{
+						"type":        "integer",
+						"description": "Lines to show before and after the match (default: 10)",
+					},
+				},
+				"required": []string{"path", "pattern"},
+			},
+		},
+	},
 	{
 		"type": "function",
 		"function": map[string]interface{}{
@@ -109,6 +229,15 @@ var ToolDefinitions = []map[string]interface{}{
 						"type":        "string",
 						"description": "Directory to search in (default: current directory)",
 					},
+					"type": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"f", "d", "both"},
+						"description": "Match files (f), directories (d), or both (default: f)",
+					},
+					"newer_than": map[string]interface{}{
+						"type":        "string",
+						"description": "Only match entries modified within this relative time (e.g., '30m', '12h', '7d', '2w')",
+					},
 				},
 				"required": []string{"pattern"},
 			},
@@ -128,13 +257,207 @@ var ToolDefinitions = []map[string]interface{}{
 					},
 					"depth": map[string]interface{}{
 						"type":        "integer",
-						"description": "Maximum depth to display (default: 3)",
+						"description": "Maximum depth to display (default: 3, range: 1-10)",
+					},
+					"dirs_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "List directories only, without files (default: false)",
+					},
+				},
+				"required": []string{},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "du",
+			"description": "Show disk usage of a directory and its subdirectories, to see where a repository's bulk lives.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Directory to measure (default: current directory)",
+					},
+					"depth": map[string]interface{}{
+						"type":        "integer",
+						"description": "How many directory levels to report (default: 1)",
+					},
+				},
+				"required": []string{},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "hexdump",
+			"description": "Show the first bytes of a binary file as an offset/hex/ASCII dump. Use this instead of cat for non-text files.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the file to dump",
+					},
+					"length": map[string]interface{}{
+						"type":        "integer",
+						"description": "Number of bytes to dump (default: 256, max: 65536)",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "hash",
+			"description": "Compute the hex digest of a file, e.g. to verify an artifact against a published checksum.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the file to hash",
+					},
+					"algo": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"sha256", "sha1", "md5"},
+						"description": "Hash algorithm (default: sha256)",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "read_symbol",
+			"description": "Find where a function, method, class, or type is defined and return its full definition with the file and line range. Faster than grep followed by cat when you know the name.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "Symbol name, e.g. LoadConfig or parse_args",
+					},
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "File or directory to search (default: current directory)",
+					},
+				},
+				"required": []string{"name"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "depends_on",
+			"description": "Check whether one Go file or package directory depends on another by scanning imports. Reports the import chain when the dependency is transitive.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "File or package directory that may depend on the other",
+					},
+					"to": map[string]interface{}{
+						"type":        "string",
+						"description": "File or package directory that may be depended on",
+					},
+				},
+				"required": []string{"from", "to"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "project_info",
+			"description": "Summarize the project manifests in a directory (go.mod, package.json, Cargo.toml, pyproject.toml): language, project name, language/runtime versions, and key dependency versions. Use this instead of reading manifests to answer questions like 'which Go version does this use?'",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Directory containing the manifests (default: current directory)",
+					},
+				},
+				"required": []string{},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "git_diff",
+			"description": "Show uncommitted changes (staged and unstaged) compared to the last commit, for one file or the current directory. Untracked files are not included.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "File or directory to diff (default: the current directory)",
 					},
 				},
 				"required": []string{},
 			},
 		},
 	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "git_show",
+			"description": "Show a file as it existed at a git revision, to compare it with the current version",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "File to show",
+					},
+					"rev": map[string]interface{}{
+						"type":        "string",
+						"description": "Commit, branch, or tag such as HEAD~1 or v1.2.0 (default: HEAD)",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "which",
+			"description": "Check whether a command-line program is installed and where. Only common development tools can be checked; nothing is executed.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "Program to look up (e.g., 'git', 'tree', 'rg', 'go', 'node')",
+					},
+				},
+				"required": []string{"name"},
+			},
+		},
+	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "list_tools",
+			"description": "List the tools available to you with their descriptions.",
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+				"required":   []string{},
+			},
+		},
+	},
 	{
 		"type": "function",
 		"function": map[string]interface{}{
@@ -156,41 +479,366 @@ var ToolDefinitions = []map[string]interface{}{
 			},
 		},
 	},
+	{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "edit_markdown",
+			"description": "Edit an existing markdown (.md) file by replacing old_text with new_text. By default old_text must occur exactly once; set all to true to replace every occurrence.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the markdown file to edit (must end with .md)",
+					},
+					"old_text": map[string]interface{}{
+						"type":        "string",
+						"description": "Exact text to replace",
+					},
+					"new_text": map[string]interface{}{
+						"type":        "string",
+						"description": "Replacement text",
+					},
+					"all": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Replace every occurrence instead of requiring a single match (default: false)",
+					},
+				},
+				"required": []string{"path", "old_text", "new_text"},
+			},
+		},
+	},
 }
 
-// ExecuteTool runs a tool and returns its output
-func ExecuteTool(name string, argsJSON string) (string, error) {
-	var args map[string]interface{}
-	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-		PrintError(fmt.Sprintf("Failed to parse tool arguments: %v", err))
-		return "", fmt.Errorf("invalid arguments: %v", err)
-	}
+// Tools that only read the filesystem; their results can be cached
+var readOnlyTools = map[string]bool{
+	"ls":           true,
+	"cat":          true,
+	"head":         true,
+	"tail":         true,
+	"grep_context": true,
+	"read_chunk":   true,
+	"grep":         true,
+	"find":         true,
+	"tree":         true,
+	"du":           true,
+	"hexdump":      true,
+	"hash":         true,
+	"git_diff":     true,
+	"git_show":     true,
+	"read_symbol":  true,
+	"depends_on":   true,
+	"project_info": true,
+	"which":        true,
+}
 
-	// Validate and sanitize paths
-	if path, ok := args["path"].(string); ok {
-		if _, err := validatePath(path); err != nil {
-			return "", err
-		}
-	}
+// Tools that modify the filesystem
+var writeTools = map[string]bool{
+	"write_markdown": true,
+	"edit_markdown":  true,
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// allowSecrets lets write tools write content that looks like a secret (-allow-secrets)
+var allowSecrets bool
 
-	switch name {
-	case "ls":
-		return executeLs(ctx, args)
+// readOnlyMode hides write tools from the model and refuses to run them (-read-only)
+var readOnlyMode bool
+
+// Tools offered to the model, set from Config.EnabledTools and
+// Config.DisabledTools. An empty enabledToolNames allows every tool.
+var (
+	enabledToolNames  []string
+	disabledToolNames []string
+)
+
+// toolEnabled reports whether the model may call name
+func toolEnabled(name string) bool {
+	if readOnlyMode && writeTools[name] {
+		return false
+	}
+	if len(enabledToolNames) > 0 && !slices.Contains(enabledToolNames, name) {
+		return false
+	}
+	return !slices.Contains(disabledToolNames, name)
+}
+
+// EnabledTools returns the tool definitions offered to the model
+func EnabledTools() []map[string]interface{} {
+	var tools []map[string]interface{}
+	for _, tool := range ToolDefinitions {
+		if fn, ok := tool["function"].(map[string]interface{}); ok && !toolEnabled(fn["name"].(string)) {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// Session cache of read-only tool results, enabled with -cache
+var (
+	toolCacheEnabled bool
+	toolCache        = make(map[string]ToolResult)
+)
+
+// HasTool reports whether name is a defined tool
+func HasTool(name string) bool {
+	return toolFunction(name) != nil
+}
+
+// toolFunction returns the "function" part of a tool definition, or nil if
+// there is no such tool
+func toolFunction(name string) map[string]interface{} {
+	for _, tool := range ToolDefinitions {
+		if fn, ok := tool["function"].(map[string]interface{}); ok && fn["name"] == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// toolProperties returns a tool's parameter schemas keyed by parameter name
+func toolProperties(name string) map[string]interface{} {
+	fn := toolFunction(name)
+	if fn == nil {
+		return nil
+	}
+	params, _ := fn["parameters"].(map[string]interface{})
+	props, _ := params["properties"].(map[string]interface{})
+	return props
+}
+
+// toolSchemaHint describes the arguments a tool expects, for correcting a
+// model that sent arguments that don't parse
+func toolSchemaHint(name string) string {
+	props := toolProperties(name)
+	if props == nil {
+		return ""
+	}
+	fn := toolFunction(name)
+	params, _ := fn["parameters"].(map[string]interface{})
+	required := make(map[string]bool)
+	if list, ok := params["required"].([]string); ok {
+		for _, r := range list {
+			required[r] = true
+		}
+	}
+
+	names := make([]string, 0, len(props))
+	for param := range props {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Call %s again with the arguments as a single JSON object", name)
+	if len(names) == 0 {
+		b.WriteString(" with no fields: {}")
+		return b.String()
+	}
+	b.WriteString(" with these fields:")
+	for _, param := range names {
+		schema, _ := props[param].(map[string]interface{})
+		fmt.Fprintf(&b, "\n- %s (%v", param, schema["type"])
+		if required[param] {
+			b.WriteString(", required")
+		}
+		fmt.Fprintf(&b, "): %v", schema["description"])
+	}
+	return b.String()
+}
+
+// errInvalidArguments marks tool calls whose arguments aren't a JSON object
+var errInvalidArguments = errors.New("invalid arguments")
+
+// ToolResult is the outcome of a tool call, sent to the model as a JSON envelope
+type ToolResult struct {
+	Output     string
+	Truncated  bool // Output was cut off at the size limit
+	Summarized bool // Output was replaced by a summary (-auto-summarize)
+	ExitCode   int  // Exit status of the command the tool ran, if it failed
+	Err        error
+}
+
+// toolEnvelope is the JSON form of a ToolResult
+type toolEnvelope struct {
+	Output     string `json:"output"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Summarized bool   `json:"summarized,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// JSON returns the envelope sent as the tool message content
+func (r ToolResult) JSON() string {
+	env := toolEnvelope{Output: r.Output, Truncated: r.Truncated, Summarized: r.Summarized, ExitCode: r.ExitCode}
+	if r.Err != nil {
+		env.Error = r.Err.Error()
+	}
+	// Leave <, > and & readable; tool output is mostly code
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(env)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// String returns the output, or the error prefixed with "Error:"
+func (r ToolResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("Error: %v", r.Err)
+	}
+	return r.Output
+}
+
+// Start of the header added by toolResultHeader
+const toolResultHeaderPrefix = "[result of "
+
+// toolResultHeader names the call a tool result came from, e.g.
+// [result of grep -r "foo" src], for Config.LabelToolResults
+func toolResultHeader(name, argsJSON string) string {
+	call := strings.TrimSpace(name + " " + FormatToolCall(name, argsJSON))
+	return toolResultHeaderPrefix + call + "]"
+}
+
+// parseToolResult reads a tool message content written by ToolResult.JSON,
+// skipping a toolResultHeader line
+func parseToolResult(content string) (ToolResult, bool) {
+	if strings.HasPrefix(content, toolResultHeaderPrefix) {
+		if _, rest, ok := strings.Cut(content, "\n"); ok {
+			content = rest
+		}
+	}
+	var env toolEnvelope
+	if err := json.Unmarshal([]byte(content), &env); err != nil {
+		return ToolResult{}, false
+	}
+	r := ToolResult{Output: env.Output, Truncated: env.Truncated, Summarized: env.Summarized, ExitCode: env.ExitCode}
+	if env.Error != "" {
+		r.Err = errors.New(env.Error)
+	}
+	return r, true
+}
+
+// ExecuteTool runs a tool and returns its output
+func ExecuteTool(name string, argsJSON string) (string, error) {
+	result := RunTool(name, argsJSON)
+	return result.Output, result.Err
+}
+
+// exitCodeKey is the context key runCommand reports exit statuses through
+type exitCodeKey struct{}
+
+// RunTool runs a tool and returns its output along with whether it was
+// truncated and the exit status of the command it ran
+func RunTool(name string, argsJSON string) ToolResult {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		PrintError(fmt.Sprintf("Failed to parse tool arguments: %v", err))
+		return ToolResult{Err: fmt.Errorf("%w: %v", errInvalidArguments, err)}
+	}
+	if readOnlyMode && writeTools[name] {
+		return ToolResult{Err: fmt.Errorf("write tools disabled")}
+	}
+	if HasTool(name) && !toolEnabled(name) {
+		return ToolResult{Err: fmt.Errorf("tool disabled")}
+	}
+
+	// Validate and sanitize paths
+	for _, key := range []string{"path", "from", "to"} {
+		if path, ok := args[key].(string); ok {
+			if _, err := validatePath(path); err != nil {
+				return ToolResult{Err: err}
+			}
+		}
+	}
+
+	// Serve repeated read-only calls from the session cache
+	cacheKey := name + "\x00" + argsJSON
+	if toolCacheEnabled && readOnlyTools[name] {
+		if result, ok := toolCache[cacheKey]; ok {
+			return result
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	exitCode := 0
+	ctx = context.WithValue(ctx, exitCodeKey{}, &exitCode)
+
+	output, err := runTool(ctx, name, args)
+	if redactOutput {
+		output = RedactSecrets(output)
+	}
+	result := ToolResult{
+		Output:    output,
+		Truncated: strings.Contains(output, truncationNotice),
+		ExitCode:  exitCode,
+		Err:       err,
+	}
+	if err == nil && toolCacheEnabled {
+		if readOnlyTools[name] {
+			toolCache[cacheKey] = result
+		} else if writeTools[name] {
+			// Files may have changed, so earlier reads are stale
+			toolCache = make(map[string]ToolResult)
+		}
+	}
+	return result
+}
+
+// runTool dispatches to the tool implementation; tests may replace it
+var runTool = dispatchTool
+
+func dispatchTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	switch name {
+	case "ls":
+		return executeLs(ctx, args)
 	case "cat":
-		return executeCat(ctx, args)
+		output, err := executeCat(ctx, args)
+		// With paths, executeCatFiles notes each file under its own header
+		if len(getStringSlice(args, "paths")) > 0 {
+			return output, err
+		}
+		return addLanguageNote(getString(args, "path", ""), output, err)
 	case "head":
-		return executeHead(ctx, args)
+		output, err := executeHead(ctx, args)
+		return addLanguageNote(getString(args, "path", ""), output, err)
+	case "tail":
+		return executeTail(ctx, args)
+	case "read_chunk":
+		return executeReadChunk(ctx, args)
+	case "grep_context":
+		return executeGrepContext(ctx, args)
 	case "grep":
 		return executeGrep(ctx, args)
 	case "find":
 		return executeFind(ctx, args)
 	case "tree":
 		return executeTree(ctx, args)
+	case "du":
+		return executeDu(ctx, args)
+	case "hexdump":
+		return executeHexdump(ctx, args)
+	case "hash":
+		return executeHash(ctx, args)
+	case "read_symbol":
+		return executeReadSymbol(ctx, args)
+	case "depends_on":
+		return executeDependsOn(ctx, args)
+	case "project_info":
+		return executeProjectInfo(ctx, args)
+	case "git_diff":
+		return executeGitDiff(ctx, args)
+	case "git_show":
+		return executeGitShow(ctx, args)
+	case "which":
+		return executeWhich(ctx, args)
+	case "list_tools":
+		return executeListTools(ctx, args)
 	case "write_markdown":
 		return executeWriteMarkdown(ctx, args)
+	case "edit_markdown":
+		return executeEditMarkdown(ctx, args)
 	default:
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
@@ -209,13 +857,47 @@ func validatePath(path string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to resolve path: %v", err)
 		}
-		if !strings.HasPrefix(abs, cwd) {
+		if !isWithinDir(cwd, abs) {
 			return "", fmt.Errorf("path traversal not allowed: %s", path)
 		}
 	}
 	return clean, nil
 }
 
+// isWithinDir reports whether the absolute path is dir or beneath it. A
+// plain prefix check would also accept siblings such as /work/project-old
+// for /work/project.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateWriteDir checks that the directory a file will be written to,
+// with symlinks resolved, is inside the current directory. validatePath
+// only looks at the path as written, so a symlinked directory could
+// otherwise point a write anywhere.
+func validateWriteDir(path string) error {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = resolved
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %v", err)
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("directory does not exist: %s", filepath.Dir(path))
+	}
+	if !isWithinDir(cwd, dir) {
+		return fmt.Errorf("path traversal not allowed: %s resolves outside the current directory", path)
+	}
+	return nil
+}
+
 func getString(args map[string]interface{}, key, defaultVal string) string {
 	if v, ok := args[key].(string); ok && v != "" {
 		return v
@@ -230,6 +912,19 @@ func getInt(args map[string]interface{}, key string, defaultVal int) int {
 	return defaultVal
 }
 
+// getStringSlice returns the strings in an array argument, skipping
+// anything else
+func getStringSlice(args map[string]interface{}, key string) []string {
+	items, _ := args[key].([]interface{})
+	var values []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
 func getBool(args map[string]interface{}, key string, defaultVal bool) bool {
 	if v, ok := args[key].(bool); ok {
 		return v
@@ -237,21 +932,65 @@ func getBool(args map[string]interface{}, key string, defaultVal bool) bool {
 	return defaultVal
 }
 
-func runCommand(ctx context.Context, name string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, name, args...)
-	output, err := cmd.CombinedOutput()
-	result := string(output)
+// Appended to output cut off by truncateOutput
+const truncationNotice = "\n... (output truncated)"
+
+// Characters of tool output kept by truncateOutput
+const maxOutputLen = 50000
+
+// Default for fullOutputLimit
+const defaultFullOutputLimit = 200000
+
+// fullOutputLimit is how much output cat and grep keep when the model sets
+// full (full_output_limit)
+var fullOutputLimit = defaultFullOutputLimit
 
-	// Truncate very long outputs
-	const maxLen = 50000
+// outputLimitKey is the context key a tool call's output limit is kept under
+type outputLimitKey struct{}
+
+// withFullOutput raises the output limit for the rest of a tool call when
+// the model asked for full output
+func withFullOutput(ctx context.Context, args map[string]interface{}) context.Context {
+	if !getBool(args, "full", false) {
+		return ctx
+	}
+	return context.WithValue(ctx, outputLimitKey{}, max(fullOutputLimit, maxOutputLen))
+}
+
+// outputLimit returns the output limit for a tool call
+func outputLimit(ctx context.Context) int {
+	if limit, ok := ctx.Value(outputLimitKey{}).(int); ok {
+		return limit
+	}
+	return maxOutputLen
+}
+
+// truncateOutput shortens very long tool output
+func truncateOutput(result string) string {
+	return truncateOutputTo(result, maxOutputLen)
+}
+
+// truncateOutputTo cuts result to maxLen characters
+func truncateOutputTo(result string, maxLen int) string {
 	if len(result) > maxLen {
-		result = result[:maxLen] + "\n... (output truncated)"
+		result = result[:maxLen] + truncationNotice
 	}
+	return result
+}
+
+func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	output, err := cmd.CombinedOutput()
+	result := truncateOutputTo(string(output), outputLimit(ctx))
 
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return "", fmt.Errorf("command timed out")
 		}
+		var exitErr *exec.ExitError
+		if code, ok := ctx.Value(exitCodeKey{}).(*int); ok && errors.As(err, &exitErr) {
+			*code = exitErr.ExitCode()
+		}
 		// Return output even on error (grep returns 1 for no matches)
 		if result != "" {
 			return result, nil
@@ -266,7 +1005,408 @@ func executeLs(ctx context.Context, args map[string]interface{}) (string, error)
 	return runCommand(ctx, "ls", "-la", path)
 }
 
-func executeCat(ctx context.Context, args map[string]interface{}) (string, error) {
+func executeCat(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if paths := getStringSlice(args, "paths"); len(paths) > 0 {
+		if path != "" && !slices.Contains(paths, path) {
+			paths = append([]string{path}, paths...)
+		}
+		return executeCatFiles(ctx, args, paths)
+	}
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	if err := checkReadSize(path, "use head or read_chunk to read part of it"); err != nil {
+		return "", err
+	}
+	number := getBool(args, "number", false)
+	ctx = withFullOutput(ctx, args)
+	limit := outputLimit(ctx)
+	if isGzip(path) {
+		text, err := readGzip(path, "use head to read the start of it")
+		if err != nil {
+			return "", err
+		}
+		if number {
+			text = numberLines(text)
+		}
+		return truncateOutputTo(text, limit), nil
+	}
+	if getBool(args, "pretty", false) && strings.EqualFold(filepath.Ext(path), ".json") {
+		// Invalid JSON falls through to the raw contents
+		if data, err := os.ReadFile(path); err == nil {
+			var indented bytes.Buffer
+			if json.Indent(&indented, data, "", "  ") == nil {
+				text := indented.String()
+				if number {
+					text = numberLines(text)
+				}
+				return truncateOutputTo(text, limit), nil
+			}
+		}
+	}
+	if detectEncoding {
+		if data, err := os.ReadFile(path); err == nil {
+			if text, encoding := transcodeToUTF8(data); encoding != "" {
+				if number {
+					text = numberLines(text)
+				}
+				return truncateOutputTo(text, limit) + fmt.Sprintf("\n[transcoded from %s to UTF-8]", encoding), nil
+			}
+		}
+	}
+	if number {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return truncateOutputTo(numberLines(string(data)), limit), nil
+	}
+	return runCommand(ctx, "cat", path)
+}
+
+// Most files one cat call reads
+const maxCatPaths = 20
+
+// executeCatFiles reads each file for a cat call with paths, under a
+// ===== path ===== line. A file that can't be read shows its error in place
+// of its contents, so the rest still come through.
+func executeCatFiles(ctx context.Context, args map[string]interface{}, paths []string) (string, error) {
+	if len(paths) > maxCatPaths {
+		return "", fmt.Errorf("too many paths (%d); read at most %d files per call", len(paths), maxCatPaths)
+	}
+	var b strings.Builder
+	for i, path := range paths {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "===== %s =====\n", path)
+
+		fileArgs := maps.Clone(args)
+		delete(fileArgs, "paths")
+		fileArgs["path"] = path
+		_, err := validatePath(path)
+		var output string
+		if err == nil {
+			output, err = executeCat(ctx, fileArgs)
+			output, err = addLanguageNote(path, output, err)
+		}
+		if err != nil {
+			output = fmt.Sprintf("Error: %v", err)
+		}
+		b.WriteString(output)
+		if !strings.HasSuffix(output, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return truncateOutputTo(b.String(), outputLimit(withFullOutput(ctx, args))), nil
+}
+
+// numberLines prefixes each line with its line number, like cat -n. A
+// truncation notice at the end is left unnumbered.
+func numberLines(text string) string {
+	text, truncated := strings.CutSuffix(text, truncationNotice)
+	if text == "" {
+		return text
+	}
+	body, newline := strings.CutSuffix(text, "\n")
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = fmt.Sprintf("%6d  %s", i+1, line)
+	}
+	text = strings.Join(lines, "\n")
+	if newline {
+		text += "\n"
+	}
+	if truncated {
+		text += truncationNotice
+	}
+	return text
+}
+
+// Default for maxReadBytes
+const defaultMaxReadBytes = 5 << 20
+
+// maxReadBytes is the largest file cat will read (max_read_bytes)
+var maxReadBytes int64 = defaultMaxReadBytes
+
+// checkReadSize refuses files over maxReadBytes before anything reads them
+func checkReadSize(path, suggestion string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil // Let the command report it
+	}
+	if maxReadBytes > 0 && info.Size() > maxReadBytes {
+		return fmt.Errorf("%s is too large to read (%s, limit %s); %s", path, formatSize(info.Size()), formatSize(maxReadBytes), suggestion)
+	}
+	return nil
+}
+
+// isGzip reports whether cat and head should decompress path
+func isGzip(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gz")
+}
+
+// openGzip opens a gzipped file for reading its decompressed contents. The
+// name without .gz is checked against the ignore list too, so secrets.env.gz
+// is as blocked as secrets.env.
+func openGzip(path string) (io.Reader, func() error, error) {
+	if inner := path[:len(path)-len(filepath.Ext(path))]; IsPathBlocked(inner) {
+		return nil, nil, fmt.Errorf("access denied: %s is in ignore list", inner)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("cannot decompress %s: %v", path, err)
+	}
+	return zr, f.Close, nil
+}
+
+// readGzip returns the decompressed contents of a gzipped file, refusing
+// ones that decompress to more than maxReadBytes
+func readGzip(path, suggestion string) (string, error) {
+	r, closeFile, err := openGzip(path)
+	if err != nil {
+		return "", err
+	}
+	defer closeFile()
+	if maxReadBytes > 0 {
+		r = io.LimitReader(r, maxReadBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("cannot decompress %s: %v", path, err)
+	}
+	if maxReadBytes > 0 && int64(len(data)) > maxReadBytes {
+		return "", fmt.Errorf("%s is too large to read (over %s decompressed); %s", path, formatSize(maxReadBytes), suggestion)
+	}
+	return string(data), nil
+}
+
+// headGzip returns the first lines of a gzipped file, decompressing only as
+// much as it needs
+func headGzip(path string, lines int, number bool) (string, error) {
+	r, closeFile, err := openGzip(path)
+	if err != nil {
+		return "", err
+	}
+	defer closeFile()
+	if maxReadBytes > 0 {
+		r = io.LimitReader(r, maxReadBytes)
+	}
+	var b strings.Builder
+	reader := bufio.NewReader(r)
+	for n := 0; n < lines; n++ {
+		line, err := reader.ReadString('\n')
+		b.WriteString(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot decompress %s: %v", path, err)
+		}
+	}
+	output := truncateOutput(b.String())
+	if number {
+		output = numberLines(output)
+	}
+	return output, nil
+}
+
+func executeHead(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	// There's no size check: head stops after the requested lines, so it
+	// can look into files too large for cat. A confused model may ask for
+	// zero or negative lines.
+	lines := max(getInt(args, "lines", 50), 1)
+	if isGzip(path) {
+		return headGzip(path, lines, getBool(args, "number", false))
+	}
+	output, err := runCommand(ctx, "head", "-n", fmt.Sprintf("%d", lines), path)
+	if err == nil && getBool(args, "number", false) {
+		output = numberLines(output)
+	}
+	return output, err
+}
+
+func executeTail(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	// Same clamp as head: zero or negative lines would print nothing
+	lines := max(getInt(args, "lines", 50), 1)
+	return runCommand(ctx, "tail", "-n", fmt.Sprintf("%d", lines), path)
+}
+
+func executeReadChunk(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	chunk := getInt(args, "chunk", 0)
+	chunkSize := getInt(args, "chunk_size", 500)
+	if chunk < 0 {
+		return "", fmt.Errorf("chunk must not be negative")
+	}
+	if chunkSize <= 0 {
+		return "", fmt.Errorf("chunk_size must be positive")
+	}
+
+	text, lineCount, err := readLines(path, chunk*chunkSize, chunkSize)
+	if err != nil {
+		return "", err
+	}
+	if lineCount == 0 {
+		return "(empty file)", nil
+	}
+
+	total := (lineCount + chunkSize - 1) / chunkSize
+	if chunk >= total {
+		return "", fmt.Errorf("chunk %d out of range: %s has %d chunks (0-%d) of %d lines", chunk, path, total, total-1, chunkSize)
+	}
+	start := chunk * chunkSize
+	end := min(start+chunkSize, lineCount)
+
+	note := fmt.Sprintf("[chunk %d of %d, lines %d-%d of %d", chunk+1, total, start+1, end, lineCount)
+	if chunk+1 < total {
+		note += fmt.Sprintf("; use chunk=%d for the next part", chunk+1)
+	}
+	note += "]"
+	return text + "\n" + note, nil
+}
+
+// readLines streams path and returns count lines starting at line start
+// (0-based), without the final newline, along with the number of lines in
+// the file. Only the requested lines are kept in memory, and those are cut
+// off at maxOutputLen, so read_chunk works on files too large for cat.
+func readLines(path string, start, count int) (string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	truncated := false
+	lines, size := 0, 0
+	var last byte
+	reader := bufio.NewReader(f)
+	for {
+		// Long lines arrive in several fragments
+		fragment, err := reader.ReadSlice('\n')
+		if len(fragment) > 0 {
+			if lines >= start && lines < start+count && !truncated {
+				if room := maxOutputLen - b.Len(); len(fragment) > room {
+					b.Write(fragment[:room])
+					truncated = true
+				} else {
+					b.Write(fragment)
+				}
+			}
+			size += len(fragment)
+			last = fragment[len(fragment)-1]
+			if last == '\n' {
+				lines++
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	// A last line without a trailing newline still counts
+	if size > 0 && last != '\n' {
+		lines++
+	}
+
+	text := strings.TrimSuffix(b.String(), "\n")
+	if truncated {
+		text += truncationNotice
+	}
+	return text, lines, nil
+}
+
+func executeGrepContext(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	pattern := getString(args, "pattern", "")
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	contextLines := getInt(args, "context", 10)
+	if contextLines < 0 {
+		return "", fmt.Errorf("context must not be negative")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %v", err)
+	}
+	if err := checkReadSize(path, "use grep to find the line number, then read_chunk"); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	match := -1
+	for i, line := range lines {
+		if re.MatchString(line) {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		return fmt.Sprintf("no match for %s in %s", pattern, path), nil
+	}
+
+	start := max(match-contextLines, 0)
+	end := min(match+contextLines+1, len(lines))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d-%d (match on line %d)\n", path, start+1, end, match+1)
+	for i := start; i < end; i++ {
+		// Mark the matching line the way grep -n marks matches and context
+		sep := "-"
+		if i == match {
+			sep = ":"
+		}
+		fmt.Fprintf(&b, "%d%s%s\n", i+1, sep, lines[i])
+	}
+	return truncateOutput(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
+func executeHexdump(ctx context.Context, args map[string]interface{}) (string, error) {
 	path := getString(args, "path", "")
 	if path == "" {
 		return "", fmt.Errorf("path is required")
@@ -274,10 +1414,40 @@ func executeCat(ctx context.Context, args map[string]interface{}) (string, error
 	if IsPathBlocked(path) {
 		return "", fmt.Errorf("access denied: %s is in ignore list", path)
 	}
-	return runCommand(ctx, "cat", path)
+
+	length := getInt(args, "length", 256)
+	const maxLength = 64 * 1024
+	if length <= 0 {
+		length = 256
+	}
+	if length > maxLength {
+		length = maxLength
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(length)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	if len(data) == 0 {
+		return "(empty file)", nil
+	}
+	return hex.Dump(data), nil
 }
 
-func executeHead(ctx context.Context, args map[string]interface{}) (string, error) {
+// Algorithms the hash tool supports
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+func executeHash(ctx context.Context, args map[string]interface{}) (string, error) {
 	path := getString(args, "path", "")
 	if path == "" {
 		return "", fmt.Errorf("path is required")
@@ -285,8 +1455,29 @@ func executeHead(ctx context.Context, args map[string]interface{}) (string, erro
 	if IsPathBlocked(path) {
 		return "", fmt.Errorf("access denied: %s is in ignore list", path)
 	}
-	lines := getInt(args, "lines", 50)
-	return runCommand(ctx, "head", "-n", fmt.Sprintf("%d", lines), path)
+	algo := strings.ToLower(getString(args, "algo", "sha256"))
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown algo %q (must be sha256, sha1, or md5)", algo)
+	}
+	if err := checkReadSize(path, "hash it outside CodeQuery"); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	return fmt.Sprintf("%s (%s) = %x", strings.ToUpper(algo), path, h.Sum(nil)), nil
 }
 
 func executeGrep(ctx context.Context, args map[string]interface{}) (string, error) {
@@ -296,43 +1487,194 @@ func executeGrep(ctx context.Context, args map[string]interface{}) (string, erro
 	}
 	path := getString(args, "path", ".")
 	recursive := getBool(args, "recursive", true)
+	maxMatches := getInt(args, "max_matches", 0)
+	contextLines := getInt(args, "context", 0)
+	ctx = withFullOutput(ctx, args)
 
-	grepArgs := []string{"-n", "--color=never"}
-	if recursive {
-		grepArgs = append(grepArgs, "-r")
+	var result string
+	var err error
+	command, grepArgs := buildGrepCommand(pattern, path, recursive, maxMatches, contextLines)
+	if _, lookErr := lookPath(command); lookErr != nil {
+		// Neither rg nor grep installed (e.g. stock Windows): search in Go
+		result, err = walkGrep(ctx, pattern, path, recursive, maxMatches, contextLines)
+	} else {
+		result, err = runCommand(ctx, command, grepArgs...)
 	}
-	// Use "--" to separate options from pattern to prevent injection
-	// (e.g., pattern "-e malicious" being interpreted as a flag)
-	grepArgs = append(grepArgs, "--", pattern, path)
-
-	result, err := runCommand(ctx, "grep", grepArgs...)
 	if err != nil {
 		return result, err
 	}
 
 	// Filter out results from blocked files
-	var filtered []string
-	for _, line := range strings.Split(result, "\n") {
+	lines := strings.Split(result, "\n")
+	var blockedFiles []string
+	for _, line := range lines {
 		// Grep output format: "filename:linenum:content" or "filename:content"
-		if idx := strings.Index(line, ":"); idx > 0 {
-			filename := line[:idx]
-			if IsPathBlocked(filename) {
-				continue
-			}
+		if idx := strings.Index(line, ":"); idx > 0 && IsPathBlocked(line[:idx]) {
+			blockedFiles = append(blockedFiles, line[:idx])
+		}
+	}
+	var filtered []string
+	for _, line := range lines {
+		if lineFromFiles(line, blockedFiles) {
+			continue
 		}
 		filtered = append(filtered, line)
 	}
 	return strings.Join(filtered, "\n"), nil
 }
 
+// lineFromFiles reports whether a grep output line belongs to one of files,
+// covering both match lines ("file:N:") and context lines ("file-N-")
+func lineFromFiles(line string, files []string) bool {
+	for _, f := range files {
+		if strings.HasPrefix(line, f+":") || strings.HasPrefix(line, f+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// walkGrep is a pure-Go stand-in for grep. It prints matches as
+// "file:line:content" and context lines as "file-line-content", with "--"
+// between separate groups, like grep -n -H.
+func walkGrep(ctx context.Context, pattern, root string, recursive bool, maxMatches, contextLines int) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %v", err)
+	}
+	pruned := make(map[string]bool)
+	for _, dir := range BlockedDirs() {
+		pruned[dir] = true
+	}
+
+	var out []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("command timed out")
+		}
+		if d.IsDir() {
+			if path != root && (!recursive || pruned[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || IsPathBlocked(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil // Unreadable or binary
+		}
+		out = append(out, grepLines(path, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), re, maxMatches, contextLines)...)
+		return nil
+	})
+	return truncateOutputTo(strings.Join(out, "\n"), outputLimit(ctx)), err
+}
+
+// grepLines formats the matches in one file's lines, separating groups
+// that aren't adjacent with "--"
+func grepLines(file string, lines []string, re *regexp.Regexp, maxMatches, contextLines int) []string {
+	var out []string
+	matches := 0
+	last := -1 // Index of the last line printed
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		start := max(i-contextLines, last+1)
+		if contextLines > 0 && (len(out) > 0 && start > last+1) {
+			out = append(out, "--")
+		}
+		for j := start; j < i; j++ {
+			out = append(out, fmt.Sprintf("%s-%d-%s", file, j+1, lines[j]))
+		}
+		out = append(out, fmt.Sprintf("%s:%d:%s", file, i+1, line))
+		last = i
+
+		// Trailing context; further matches in it are printed by later iterations
+		for j := i + 1; j <= min(i+contextLines, len(lines)-1) && !re.MatchString(lines[j]); j++ {
+			out = append(out, fmt.Sprintf("%s-%d-%s", file, j+1, lines[j]))
+			last = j
+		}
+
+		matches++
+		if maxMatches > 0 && matches >= maxMatches {
+			break
+		}
+	}
+	return out
+}
+
+// lookPath finds executables; tests may replace it
+var lookPath = exec.LookPath
+
+// buildGrepCommand prefers ripgrep when installed and falls back to grep.
+// Both are configured to print "file:line:content" so results look the same.
+func buildGrepCommand(pattern, path string, recursive bool, maxMatches, contextLines int) (string, []string) {
+	if _, err := lookPath("rg"); err == nil {
+		rgArgs := []string{"--no-heading", "--with-filename", "--line-number", "--color=never"}
+		if !recursive {
+			rgArgs = append(rgArgs, "--max-depth=1")
+		}
+		for _, dir := range BlockedDirs() {
+			rgArgs = append(rgArgs, "--glob=!"+dir)
+		}
+		if maxMatches > 0 {
+			rgArgs = append(rgArgs, fmt.Sprintf("--max-count=%d", maxMatches))
+		}
+		if contextLines > 0 {
+			rgArgs = append(rgArgs, fmt.Sprintf("--context=%d", contextLines))
+		}
+		return "rg", append(rgArgs, "--", pattern, path)
+	}
+
+	grepArgs := []string{"-n", "-H", "--color=never"}
+	if recursive {
+		grepArgs = append(grepArgs, "-r")
+		for _, dir := range BlockedDirs() {
+			grepArgs = append(grepArgs, "--exclude-dir="+dir)
+		}
+	}
+	if maxMatches > 0 {
+		grepArgs = append(grepArgs, fmt.Sprintf("--max-count=%d", maxMatches))
+	}
+	if contextLines > 0 {
+		grepArgs = append(grepArgs, fmt.Sprintf("--context=%d", contextLines))
+	}
+	// Use "--" to separate options from pattern to prevent injection
+	// (e.g., pattern "-e malicious" being interpreted as a flag)
+	return "grep", append(grepArgs, "--", pattern, path)
+}
+
 func executeFind(ctx context.Context, args map[string]interface{}) (string, error) {
 	pattern := getString(args, "pattern", "")
 	if pattern == "" {
 		return "", fmt.Errorf("pattern is required")
 	}
 	path := getString(args, "path", ".")
+	fileType := getString(args, "type", "f")
+	if fileType != "f" && fileType != "d" && fileType != "both" {
+		return "", fmt.Errorf("invalid type: %s (must be f, d, or both)", fileType)
+	}
+	newerThan := getString(args, "newer_than", "")
 
-	result, err := runCommand(ctx, "find", path, "-name", pattern, "-type", "f")
+	var result string
+	var err error
+	if _, lookErr := lookPath("find"); lookErr != nil {
+		// No find binary (e.g. Windows): walk the tree in Go instead
+		var age time.Duration
+		if newerThan != "" {
+			if age, err = parseNewerThan(newerThan); err != nil {
+				return "", err
+			}
+		}
+		result, err = walkFind(ctx, path, pattern, fileType, age)
+	} else {
+		result, err = runFind(ctx, path, pattern, fileType, newerThan)
+	}
 	if err != nil {
 		return result, err
 	}
@@ -349,19 +1691,317 @@ func executeFind(ctx context.Context, args map[string]interface{}) (string, erro
 	return strings.Join(filtered, "\n"), nil
 }
 
+// runFind runs the find binary, pruning ignored directories
+func runFind(ctx context.Context, path, pattern, fileType, newerThan string) (string, error) {
+	findArgs := append([]string{path}, findPruneArgs()...)
+	findArgs = append(findArgs, "-name", pattern)
+	if fileType != "both" {
+		findArgs = append(findArgs, "-type", fileType)
+	}
+	if newerThan != "" {
+		timeArgs, err := findTimeArgs(newerThan)
+		if err != nil {
+			return "", err
+		}
+		findArgs = append(findArgs, timeArgs...)
+	}
+	findArgs = append(findArgs, "-print")
+
+	return runCommand(ctx, "find", findArgs...)
+}
+
+// findPruneArgs returns the find expression "( -name a -o -name b ) -prune -o"
+// that skips ignored directories, or nothing when there are none
+func findPruneArgs() []string {
+	dirs := BlockedDirs()
+	if len(dirs) == 0 {
+		return nil
+	}
+	args := []string{"("}
+	for i, dir := range dirs {
+		if i > 0 {
+			args = append(args, "-o")
+		}
+		args = append(args, "-name", dir)
+	}
+	return append(args, ")", "-prune", "-o")
+}
+
+// walkFind is a pure-Go stand-in for find: it matches pattern against base
+// names under root, skipping ignored directories. A zero age matches any time.
+func walkFind(ctx context.Context, root, pattern, fileType string, age time.Duration) (string, error) {
+	pruned := make(map[string]bool)
+	for _, dir := range BlockedDirs() {
+		pruned[dir] = true
+	}
+	var cutoff time.Time
+	if age > 0 {
+		cutoff = time.Now().Add(-age)
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("command timed out")
+		}
+		if d.IsDir() && path != root && pruned[d.Name()] {
+			return filepath.SkipDir
+		}
+		if (fileType == "f" && !d.Type().IsRegular()) || (fileType == "d" && !d.IsDir()) {
+			return nil
+		}
+		if matched, _ := filepath.Match(pattern, d.Name()); !matched {
+			return nil
+		}
+		if !cutoff.IsZero() {
+			info, err := d.Info()
+			if err != nil || !info.ModTime().After(cutoff) {
+				return nil
+			}
+		}
+		matches = append(matches, path)
+		return nil
+	})
+	return strings.Join(matches, "\n"), err
+}
+
+// parseNewerThan converts a relative age like "30m", "12h", "7d", or "2w" to a duration
+func parseNewerThan(newerThan string) (time.Duration, error) {
+	if len(newerThan) < 2 {
+		return 0, fmt.Errorf("invalid newer_than: %s (use e.g. 30m, 12h, 7d, 2w)", newerThan)
+	}
+	n, err := strconv.Atoi(newerThan[:len(newerThan)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid newer_than: %s (use e.g. 30m, 12h, 7d, 2w)", newerThan)
+	}
+
+	switch newerThan[len(newerThan)-1] {
+	case 'm':
+		return time.Duration(n) * time.Minute, nil
+	case 'h':
+		return time.Duration(n) * time.Hour, nil
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, nil
+	case 'w':
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid newer_than: %s (use e.g. 30m, 12h, 7d, 2w)", newerThan)
+}
+
+// findTimeArgs converts a relative age like "7d" or "12h" into find arguments.
+// Whole days map to -mtime; smaller units use -newermt with an absolute timestamp.
+func findTimeArgs(newerThan string) ([]string, error) {
+	d, err := parseNewerThan(newerThan)
+	if err != nil {
+		return nil, err
+	}
+	switch newerThan[len(newerThan)-1] {
+	case 'd', 'w':
+		return []string{"-mtime", fmt.Sprintf("-%d", int(d/(24*time.Hour)))}, nil
+	}
+	since := time.Now().Add(-d).Format("2006-01-02 15:04:05")
+	return []string{"-newermt", since}, nil
+}
+
+// Deepest tree listing allowed; deeper requests are clamped
+const maxTreeDepth = 10
+
+// clampTreeDepth keeps a requested tree depth between 1 and maxTreeDepth
+func clampTreeDepth(depth int) int {
+	return min(max(depth, 1), maxTreeDepth)
+}
+
 func executeTree(ctx context.Context, args map[string]interface{}) (string, error) {
 	path := getString(args, "path", ".")
-	depth := getInt(args, "depth", 3)
+	depth := clampTreeDepth(getInt(args, "depth", 3))
+	dirsOnly := getBool(args, "dirs_only", false)
 
 	// Try tree command first, fall back to find if not available
-	result, err := runCommand(ctx, "tree", "-L", fmt.Sprintf("%d", depth), path)
+	result, err := runCommand(ctx, "tree", treeArgs(path, depth, dirsOnly)...)
 	if err != nil {
 		// Fallback: use find to simulate tree
-		return runCommand(ctx, "find", path, "-maxdepth", fmt.Sprintf("%d", depth), "-print")
+		return runCommand(ctx, "find", treeFallbackArgs(path, depth, dirsOnly)...)
 	}
 	return result, nil
 }
 
+// treeArgs builds the arguments for the tree command
+func treeArgs(path string, depth int, dirsOnly bool) []string {
+	args := []string{"-L", fmt.Sprintf("%d", depth)}
+	if dirsOnly {
+		args = append(args, "-d")
+	}
+	if dirs := BlockedDirs(); len(dirs) > 0 {
+		args = append(args, "-I", strings.Join(dirs, "|"))
+	}
+	return append(args, path)
+}
+
+// treeFallbackArgs builds find arguments that approximate tree output
+func treeFallbackArgs(path string, depth int, dirsOnly bool) []string {
+	args := []string{path, "-maxdepth", fmt.Sprintf("%d", depth)}
+	args = append(args, findPruneArgs()...)
+	if dirsOnly {
+		args = append(args, "-type", "d")
+	}
+	return append(args, "-print")
+}
+
+func executeDu(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", ".")
+	depth := getInt(args, "depth", 1)
+	if depth < 0 {
+		return "", fmt.Errorf("depth must not be negative")
+	}
+	if IsPathBlocked(path) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+
+	var result string
+	var err error
+	if _, lookErr := lookPath("du"); lookErr != nil {
+		result, err = walkDu(ctx, path, depth)
+	} else {
+		result, err = runCommand(ctx, "du", duArgs(path, depth)...)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// Drop entries for blocked paths; du prints "size<TAB>path"
+	var filtered []string
+	for _, line := range strings.Split(strings.TrimRight(result, "\n"), "\n") {
+		if _, p, ok := strings.Cut(line, "\t"); ok && IsPathBlocked(p) {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	return strings.Join(filtered, "\n"), nil
+}
+
+// duArgs builds the arguments for the du command. -d rather than GNU's
+// --max-depth, which BSD and macOS du reject.
+func duArgs(path string, depth int) []string {
+	return []string{"-h", "-d", strconv.Itoa(depth), path}
+}
+
+// walkDu is a pure-Go stand-in for du -h: it totals file sizes for root and
+// each directory up to depth levels below it, listing the total last
+func walkDu(ctx context.Context, root string, depth int) (string, error) {
+	sizes := make(map[string]int64)
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("command timed out")
+		}
+		rel, _ := filepath.Rel(root, path)
+		level := 0
+		if rel != "." {
+			level = len(strings.Split(rel, string(filepath.Separator)))
+		}
+		if d.IsDir() {
+			if level <= depth {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if path == root {
+			// du on a single file reports just that file
+			dirs = append(dirs, path)
+			sizes[path] = info.Size()
+			return nil
+		}
+
+		// Credit the file to every reported directory above it
+		dir := filepath.Dir(path)
+		for {
+			sizes[dir] += info.Size()
+			if dir == root || dir == filepath.Dir(dir) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// du lists subdirectories before the directories containing them
+	var lines []string
+	for i := len(dirs) - 1; i >= 0; i-- {
+		lines = append(lines, fmt.Sprintf("%s\t%s", formatSize(sizes[dirs[i]]), dirs[i]))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatSize renders a byte count the way du -h does (e.g. 512, 4.0K, 1.2M)
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d", n)
+	}
+	value := float64(n)
+	suffixes := []string{"K", "M", "G", "T"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%s", value, suffixes[i])
+	}
+	return fmt.Sprintf("%.0f%s", value, suffixes[i])
+}
+
+// Programs the which tool may look up
+var whichAllowed = map[string]bool{
+	"git": true, "tree": true, "rg": true, "grep": true, "find": true,
+	"du": true, "tail": true, "head": true, "cat": true, "ls": true,
+	"make": true, "docker": true, "go": true, "node": true, "npm": true,
+	"yarn": true, "pnpm": true, "python": true, "python3": true, "pip": true,
+	"ruby": true, "bundle": true, "cargo": true, "rustc": true, "java": true,
+	"mvn": true, "gradle": true, "dotnet": true, "php": true, "composer": true,
+}
+
+func executeWhich(ctx context.Context, args map[string]interface{}) (string, error) {
+	name := getString(args, "name", "")
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if !whichAllowed[name] {
+		return "", fmt.Errorf("cannot look up %s: not in the list of allowed programs", name)
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Sprintf("%s: not found", name), nil
+	}
+	return path, nil
+}
+
+func executeListTools(ctx context.Context, args map[string]interface{}) (string, error) {
+	var lines []string
+	for _, tool := range EnabledTools() {
+		fn, ok := tool["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", fn["name"], fn["description"]))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
 func executeWriteMarkdown(ctx context.Context, args map[string]interface{}) (string, error) {
 	path := getString(args, "path", "")
 	if path == "" {
@@ -378,6 +2018,13 @@ func executeWriteMarkdown(ctx context.Context, args map[string]interface{}) (str
 		return "", fmt.Errorf("content is required")
 	}
 
+	// Refuse to persist secrets the model may have read earlier
+	if !allowSecrets {
+		if secret, found := FindSecret(content); found {
+			return "", fmt.Errorf("content contains what looks like a secret (%s, matching %s); remove it or run with -allow-secrets", secret.name, secret.re)
+		}
+	}
+
 	// Format the markdown content to remove excessive whitespace
 	formattedContent := formatMarkdown(content)
 
@@ -392,10 +2039,9 @@ func executeWriteMarkdown(ctx context.Context, args map[string]interface{}) (str
 		return "", fmt.Errorf("file already exists: %s", path)
 	}
 
-	// Check if parent directory exists
-	dir := filepath.Dir(clean)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return "", fmt.Errorf("directory does not exist: %s", dir)
+	// The parent directory must already exist inside the current directory
+	if err := validateWriteDir(clean); err != nil {
+		return "", err
 	}
 
 	// Write the file
@@ -406,6 +2052,77 @@ func executeWriteMarkdown(ctx context.Context, args map[string]interface{}) (str
 	return fmt.Sprintf("Successfully created markdown file: %s", path), nil
 }
 
+func executeEditMarkdown(ctx context.Context, args map[string]interface{}) (string, error) {
+	path := getString(args, "path", "")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ".md") {
+		return "", fmt.Errorf("only markdown files (.md) can be edited")
+	}
+
+	oldText := getString(args, "old_text", "")
+	if oldText == "" {
+		return "", fmt.Errorf("old_text is required")
+	}
+	newText := getString(args, "new_text", "")
+	replaceAll := getBool(args, "all", false)
+
+	if !allowSecrets {
+		if secret, found := FindSecret(newText); found {
+			return "", fmt.Errorf("new_text contains what looks like a secret (%s, matching %s); remove it or run with -allow-secrets", secret.name, secret.re)
+		}
+	}
+
+	clean, err := validatePath(path)
+	if err != nil {
+		return "", err
+	}
+	if IsPathBlocked(clean) {
+		return "", fmt.Errorf("access denied: %s is in ignore list", path)
+	}
+	if err := validateWriteDir(clean); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(clean)
+	if err != nil {
+		return "", fmt.Errorf("file does not exist: %s", path)
+	}
+	data, err := os.ReadFile(clean)
+	if err != nil {
+		return "", err
+	}
+	content := string(data)
+
+	count := strings.Count(content, oldText)
+	switch {
+	case count == 0:
+		return "", fmt.Errorf("old_text not found in %s", path)
+	case count > 1 && !replaceAll:
+		return "", fmt.Errorf("old_text matches %d times in %s; add surrounding context to make it unique or set all to true", count, path)
+	}
+
+	if replaceAll {
+		content = strings.ReplaceAll(content, oldText, newText)
+	} else {
+		content = strings.Replace(content, oldText, newText, 1)
+	}
+
+	if err := os.WriteFile(clean, []byte(content), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to write file: %v", err)
+	}
+
+	if replaceAll {
+		noun := "occurrences"
+		if count == 1 {
+			noun = "occurrence"
+		}
+		return fmt.Sprintf("Edited %s: replaced %d %s", path, count, noun), nil
+	}
+	return fmt.Sprintf("Edited %s: replaced 1 occurrence", path), nil
+}
+
 // formatMarkdown cleans up markdown content by:
 // - Normalizing line endings to \n
 // - Limiting consecutive blank lines to a maximum of 2
@@ -453,30 +2170,99 @@ func FormatToolCall(name string, argsJSON string) string {
 	case "ls":
 		path := getString(args, "path", ".")
 		return path
-	case "cat", "head":
+	case "cat", "head", "tail":
 		path := getString(args, "path", "")
+		if paths := getStringSlice(args, "paths"); len(paths) > 0 {
+			if path != "" && !slices.Contains(paths, path) {
+				paths = append([]string{path}, paths...)
+			}
+			path = strings.Join(paths, " ")
+		}
 		if lines := getInt(args, "lines", 0); lines > 0 {
 			return fmt.Sprintf("%s -n %d", path, lines)
 		}
+		if getBool(args, "pretty", false) {
+			path += " --pretty"
+		}
+		if getBool(args, "number", false) {
+			path += " --number"
+		}
 		return path
 	case "grep":
 		pattern := getString(args, "pattern", "")
 		path := getString(args, "path", ".")
+		var opts string
+		if maxMatches := getInt(args, "max_matches", 0); maxMatches > 0 {
+			opts += fmt.Sprintf("-m %d ", maxMatches)
+		}
+		if contextLines := getInt(args, "context", 0); contextLines > 0 {
+			opts += fmt.Sprintf("-C %d ", contextLines)
+		}
 		if getBool(args, "recursive", true) {
-			return fmt.Sprintf("-r \"%s\" %s", pattern, path)
+			return fmt.Sprintf("-r %s\"%s\" %s", opts, pattern, path)
 		}
-		return fmt.Sprintf("\"%s\" %s", pattern, path)
+		return fmt.Sprintf("%s\"%s\" %s", opts, pattern, path)
 	case "find":
 		pattern := getString(args, "pattern", "")
 		path := getString(args, "path", ".")
-		return fmt.Sprintf("\"%s\" %s", pattern, path)
+		var opts string
+		if fileType := getString(args, "type", "f"); fileType != "f" {
+			opts += fmt.Sprintf(" -type %s", fileType)
+		}
+		if newerThan := getString(args, "newer_than", ""); newerThan != "" {
+			opts += fmt.Sprintf(" -newer %s", newerThan)
+		}
+		return fmt.Sprintf("\"%s\" %s%s", pattern, path, opts)
 	case "tree":
 		path := getString(args, "path", ".")
-		depth := getInt(args, "depth", 3)
+		depth := clampTreeDepth(getInt(args, "depth", 3))
+		if getBool(args, "dirs_only", false) {
+			return fmt.Sprintf("-d -L %d %s", depth, path)
+		}
 		return fmt.Sprintf("-L %d %s", depth, path)
+	case "du":
+		return fmt.Sprintf("-d %d %s", getInt(args, "depth", 1), getString(args, "path", "."))
+	case "git_diff":
+		return getString(args, "path", ".")
+	case "git_show":
+		return getString(args, "rev", "HEAD") + ":" + getString(args, "path", "")
+	case "which":
+		return getString(args, "name", "")
+	case "list_tools":
+		return ""
 	case "write_markdown":
 		path := getString(args, "path", "")
 		return path
+	case "edit_markdown":
+		path := getString(args, "path", "")
+		if getBool(args, "all", false) {
+			return path + " --all"
+		}
+		return path
+	case "read_chunk":
+		path := getString(args, "path", "")
+		return fmt.Sprintf("%s chunk %d", path, getInt(args, "chunk", 0))
+	case "grep_context":
+		return fmt.Sprintf("-C %d \"%s\" %s", getInt(args, "context", 10), getString(args, "pattern", ""), getString(args, "path", ""))
+	case "hexdump":
+		path := getString(args, "path", "")
+		if length := getInt(args, "length", 0); length > 0 {
+			return fmt.Sprintf("%s -n %d", path, length)
+		}
+		return path
+	case "hash":
+		return fmt.Sprintf("%s %s", getString(args, "algo", "sha256"), getString(args, "path", ""))
+	case "read_symbol":
+		if path := getString(args, "path", ""); path != "" {
+			return fmt.Sprintf("%s %s", getString(args, "name", ""), path)
+		}
+		return getString(args, "name", "")
+	case "depends_on":
+		from := getString(args, "from", "")
+		to := getString(args, "to", "")
+		return fmt.Sprintf("%s -> %s", from, to)
+	case "project_info":
+		return getString(args, "path", ".")
 	default:
 		return argsJSON
 	}
@@ -1,25 +1,45 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/chzyer/readline"
 	"github.com/fatih/color"
 )
 
 var Version = "dev"
 
+// Name shown in the welcome banner unless the config sets app_name
+const defaultAppName = "CodeQuery"
+
 var (
 	toolColor    = color.New(color.FgCyan, color.Faint)
 	errorColor   = color.New(color.FgRed)
 	successColor = color.New(color.FgGreen)
 	dimColor     = color.New(color.Faint)
+	dirColor     = color.New(color.FgBlue, color.Bold)
+	execColor    = color.New(color.FgGreen)
+	linkColor    = color.New(color.FgCyan)
 )
 
-func PrintTool(name string, args string) {
-	toolColor.Printf("[tool] %s %s\n", name, args)
+// ConfigureColor turns ANSI colors on or off for all output. Colors stay off
+// when NO_COLOR is set (https://no-color.org) regardless of enabled.
+func ConfigureColor(enabled bool) {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || !enabled {
+		color.NoColor = true
+	}
+}
+
+func PrintTool(w io.Writer, name string, args string) {
+	toolColor.Fprintf(w, "[tool] %s %s\n", name, args)
 }
 
 func PrintDebug(label string, content string) {
@@ -33,19 +53,259 @@ func PrintDebug(label string, content string) {
 	dimColor.Printf("%s\n", content)
 }
 
+// PrintDebugLs prints `ls -la` output line by line with directories,
+// executables, and symlinks colorized
+func PrintDebugLs(content string) {
+	dimColor.Println("  [result]")
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		fmt.Printf("    %s\n", ColorizeLsLine(line))
+	}
+}
+
+// Lines of tree output shown in debug mode on a terminal
+const debugTreeLines = 40
+
+// PrintDebugTree prints tree output line by line. On a terminal it stops
+// after debugTreeLines lines; the model still gets the whole tree.
+func PrintDebugTree(content string) {
+	if terminalHeight() > 0 {
+		content = truncateLines(content, debugTreeLines, "use depth to narrow")
+	}
+	dimColor.Println("  [result]")
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+// truncateLines keeps the first max lines of content, ending with a note
+// that says how many lines there were and how to see fewer
+func truncateLines(content string, max int, hint string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if len(lines) <= max {
+		return content
+	}
+	note := fmt.Sprintf("... showing first %d of %d lines, %s", max, len(lines), hint)
+	return strings.Join(append(lines[:max:max], note), "\n")
+}
+
+// ColorizeLsLine colors one line of `ls -la` output based on the file type
+// and permission bits in its mode column. Other lines are returned unchanged.
+func ColorizeLsLine(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 9 || len(fields[0]) < 10 {
+		return line // "total N" header or unexpected format
+	}
+	mode := fields[0]
+	switch {
+	case mode[0] == 'd':
+		return dirColor.Sprint(line)
+	case mode[0] == 'l':
+		return linkColor.Sprint(line)
+	case mode[0] == '-' && strings.ContainsAny(mode[1:10], "xs"):
+		return execColor.Sprint(line)
+	}
+	return line
+}
+
+// PrintThinking shows a reasoning model's thinking dimmed in debug mode
+func PrintThinking(thinking string) {
+	dimColor.Println("  [thinking]")
+	for _, line := range strings.Split(strings.TrimSpace(thinking), "\n") {
+		dimColor.Printf("    %s\n", line)
+	}
+}
+
 func PrintDebugJSON(label string, content string) {
 	dimColor.Printf("  [%s] %s\n", label, content)
 }
 
+// debugToolCall is the line PrintDebugStructured prints for a tool call
+type debugToolCall struct {
+	Name         string          `json:"name"`
+	Args         json.RawMessage `json:"args"`
+	ResultLength int             `json:"result_length"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// PrintDebugStructured writes a tool call and its result to w as one line
+// of JSON (-debug-json), for piping to jq. Arguments that aren't valid JSON
+// are quoted as a string.
+func PrintDebugStructured(w io.Writer, name, argsJSON, result string) {
+	call := debugToolCall{Name: name, ResultLength: len(result)}
+	var args bytes.Buffer
+	if json.Compact(&args, []byte(argsJSON)) == nil {
+		call.Args = args.Bytes()
+	} else {
+		call.Args, _ = json.Marshal(argsJSON)
+	}
+	if msg, ok := strings.CutPrefix(result, "Error: "); ok {
+		call.Error = msg
+		call.ResultLength = 0
+	}
+	data, err := json.Marshal(call)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
+
+// PrintSources prints the footer listing the tool calls an answer was based on
+func PrintSources(sources []string) {
+	if len(sources) == 0 {
+		return
+	}
+	dimColor.Println("Sources:")
+	for _, source := range sources {
+		dimColor.Printf("  - %s\n", source)
+	}
+	fmt.Println()
+}
+
+// PrintModels lists model IDs, marking the one currently in use
+func PrintModels(models []string, current string) {
+	for _, m := range models {
+		if m == current {
+			successColor.Printf("* %s\n", m)
+		} else {
+			fmt.Printf("  %s\n", m)
+		}
+	}
+}
+
+// PrintTiming prints how long a query took and, when the provider reported
+// usage, how many tokens were generated and at what rate
+func PrintTiming(d time.Duration, tokens int) {
+	dimColor.Println(FormatTiming(d, tokens))
+}
+
+// FormatTiming renders the line printed by PrintTiming
+func FormatTiming(d time.Duration, tokens int) string {
+	elapsed := d.Round(100 * time.Millisecond)
+	if d < time.Second {
+		elapsed = d.Round(time.Millisecond)
+	}
+	if tokens <= 0 || d <= 0 {
+		return fmt.Sprintf("Took %s", elapsed)
+	}
+	rate := float64(tokens) / d.Seconds()
+	return fmt.Sprintf("Took %s, %d tokens (%.1f tokens/s)", elapsed, tokens, rate)
+}
+
+// terminalHeight returns the number of rows in the terminal on stdout, or 0
+// when stdout isn't a terminal; tests may replace it
+var terminalHeight = func() int {
+	fd := int(os.Stdout.Fd())
+	if !readline.IsTerminal(fd) {
+		return 0
+	}
+	_, height, err := readline.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// terminalWidth returns the number of columns in the terminal on stdout, or 0
+// when stdout isn't a terminal
+func terminalWidth() int {
+	fd := int(os.Stdout.Fd())
+	if !readline.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := readline.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// WrapText word-wraps each line of s to width columns. Continuation lines
+// keep the line's indentation, words longer than width are left whole, and
+// fenced code blocks are not touched. A width of 0 or less returns s as is.
+func WrapText(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+
+	var out []string
+	inCode := false
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			out = append(out, line)
+			continue
+		}
+		if inCode || len([]rune(line)) <= width {
+			out = append(out, line)
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		current := ""
+		for _, word := range strings.Fields(line) {
+			switch {
+			case current == "":
+				current = indent + word
+			case len([]rune(current))+1+len([]rune(word)) <= width:
+				current += " " + word
+			default:
+				out = append(out, current)
+				current = indent + word
+			}
+		}
+		out = append(out, current)
+	}
+	return strings.Join(out, "\n")
+}
+
+// runPager shows text in $PAGER, or less when PAGER is unset; tests may replace it
+var runPager = func(text string) error {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less", "-R"}
+	}
+	if _, err := exec.LookPath(pager[0]); err != nil {
+		return err
+	}
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// PageOutput prints text, sending it through a pager when it is taller than
+// the terminal. Short text, non-terminal output, and a missing pager all fall
+// back to printing directly.
+func PageOutput(text string) {
+	height := terminalHeight()
+	if height == 0 || strings.Count(text, "\n")+1 < height {
+		fmt.Println(text)
+		return
+	}
+	if err := runPager(text); err != nil {
+		fmt.Println(text)
+	}
+}
+
 func PrintError(msg string) {
 	errorColor.Printf("Error: %s\n", msg)
 }
 
-func PrintWelcome(model, baseURL string) {
-	fmt.Println()
-	successColor.Printf("CodeQuery %s\n", Version)
-	dimColor.Printf("Model: %s | Provider: %s\n", model, baseURL)
-	fmt.Println()
+// PrintWelcome writes the startup banner, name and version, and the model in use
+func PrintWelcome(w io.Writer, cfg *Config) {
+	name := cfg.AppName
+	if name == "" {
+		name = defaultAppName
+	}
+
+	fmt.Fprintln(w)
+	if cfg.Banner != "" {
+		fmt.Fprintln(w, strings.TrimRight(cfg.Banner, "\n"))
+	}
+	successColor.Fprintf(w, "%s %s\n", name, Version)
+	dimColor.Fprintf(w, "Model: %s | Provider: %s\n", cfg.Model, extractHost(cfg.BaseURL))
+	fmt.Fprintln(w)
 }
 
 // Spinner provides a simple animated spinner
@@ -55,6 +315,7 @@ type Spinner struct {
 	stopped chan struct{}
 	mu      sync.Mutex
 	running bool
+	msg     string
 }
 
 func NewSpinner() *Spinner {
@@ -72,6 +333,7 @@ func (s *Spinner) Start(msg string) {
 		return
 	}
 	s.running = true
+	s.msg = msg
 	s.stop = make(chan struct{})
 	s.stopped = make(chan struct{})
 	s.mu.Unlock()
@@ -79,13 +341,26 @@ func (s *Spinner) Start(msg string) {
 	go func() {
 		defer close(s.stopped)
 		i := 0
+		width := 0 // Longest message shown, to clear leftovers when it changes
 		for {
+			s.mu.Lock()
+			msg := s.msg
+			s.mu.Unlock()
+			if n := len([]rune(msg)); n > width {
+				width = n
+			}
+
 			select {
 			case <-s.stop:
-				fmt.Print("\r\033[K") // Clear line
+				if color.NoColor {
+					// Overwrite with spaces rather than an erase-line escape
+					fmt.Printf("\r%s\r", strings.Repeat(" ", width+2))
+				} else {
+					fmt.Print("\r\033[K") // Clear line
+				}
 				return
 			default:
-				dimColor.Printf("\r%s %s", s.frames[i%len(s.frames)], msg)
+				dimColor.Printf("\r%s %-*s", s.frames[i%len(s.frames)], width, msg)
 				i++
 				time.Sleep(80 * time.Millisecond)
 			}
@@ -93,6 +368,13 @@ func (s *Spinner) Start(msg string) {
 	}()
 }
 
+// SetMessage changes the text shown next to a running spinner
+func (s *Spinner) SetMessage(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msg = msg
+}
+
 func (s *Spinner) Stop() {
 	s.mu.Lock()
 	if !s.running {
@@ -105,3 +387,30 @@ func (s *Spinner) Stop() {
 	close(s.stop)
 	<-s.stopped
 }
+
+// Tools whose target is a directory searched, rather than a file read
+var directoryTools = map[string]bool{
+	"ls": true, "grep": true, "find": true, "tree": true, "du": true, "read_symbol": true, "project_info": true,
+}
+
+// toolProgressMessage describes a tool that is still running, e.g.
+// "Running grep in src..."
+func toolProgressMessage(name, argsJSON string) string {
+	var args map[string]interface{}
+	json.Unmarshal([]byte(argsJSON), &args)
+
+	target := getString(args, "path", "")
+	if target == "" {
+		target = getString(args, "from", "")
+	}
+	switch {
+	case (target == "" || target == ".") && directoryTools[name]:
+		return fmt.Sprintf("Running %s in the current directory...", name)
+	case target == "":
+		return fmt.Sprintf("Running %s...", name)
+	}
+	if directoryTools[name] {
+		return fmt.Sprintf("Running %s in %s...", name, target)
+	}
+	return fmt.Sprintf("Running %s on %s...", name, target)
+}
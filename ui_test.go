@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// forceColor enables ANSI output even though tests don't run in a terminal
+func forceColor(t *testing.T) {
+	t.Helper()
+	orig := color.NoColor
+	color.NoColor = false
+	t.Cleanup(func() { color.NoColor = orig })
+}
+
+func TestColorizeLsLine(t *testing.T) {
+	forceColor(t)
+
+	dirLine := "drwxr-xr-x  5 user staff  160 Jan  2 10:00 src"
+	fileLine := "-rw-r--r--  1 user staff 1024 Jan  2 10:00 main.go"
+	execLine := "-rwxr-xr-x  1 user staff 2048 Jan  2 10:00 build.sh"
+	linkLine := "lrwxrwxrwx  1 user staff   10 Jan  2 10:00 latest -> v2"
+
+	if got := ColorizeLsLine(dirLine); got != dirColor.Sprint(dirLine) {
+		t.Errorf("directory line = %q, want directory color", got)
+	}
+	if got := ColorizeLsLine(fileLine); got != fileLine {
+		t.Errorf("regular file line = %q, want unchanged", got)
+	}
+	if got := ColorizeLsLine(execLine); got != execColor.Sprint(execLine) {
+		t.Errorf("executable line = %q, want executable color", got)
+	}
+	if got := ColorizeLsLine(linkLine); got != linkColor.Sprint(linkLine) {
+		t.Errorf("symlink line = %q, want symlink color", got)
+	}
+	if !strings.Contains(ColorizeLsLine(dirLine), "\x1b[") {
+		t.Error("directory line should contain an ANSI escape sequence")
+	}
+}
+
+func TestColorizeLsLine_Header(t *testing.T) {
+	forceColor(t)
+
+	if got := ColorizeLsLine("total 48"); got != "total 48" {
+		t.Errorf("header line = %q, want unchanged", got)
+	}
+}
+
+func TestFormatTiming(t *testing.T) {
+	tests := []struct {
+		d      time.Duration
+		tokens int
+		want   string
+	}{
+		{3200 * time.Millisecond, 0, "Took 3.2s"},
+		{2 * time.Second, 150, "Took 2s, 150 tokens (75.0 tokens/s)"},
+		{1234 * time.Millisecond, 100, "Took 1.2s, 100 tokens (81.0 tokens/s)"},
+		{450 * time.Millisecond, 0, "Took 450ms"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatTiming(tt.d, tt.tokens); got != tt.want {
+			t.Errorf("FormatTiming(%v, %d) = %q, want %q", tt.d, tt.tokens, got, tt.want)
+		}
+	}
+}
+
+// stubPager replaces the terminal height and pager, recording pager calls
+func stubPager(t *testing.T, height int) *int {
+	t.Helper()
+	origHeight, origPager := terminalHeight, runPager
+	calls := 0
+	terminalHeight = func() int { return height }
+	runPager = func(text string) error {
+		calls++
+		return nil
+	}
+	t.Cleanup(func() { terminalHeight, runPager = origHeight, origPager })
+	return &calls
+}
+
+func TestTruncateLines(t *testing.T) {
+	tree := ".\n├── a.go\n├── b.go\n└── c.go\n"
+	if got := truncateLines(tree, 4, "use depth to narrow"); got != tree {
+		t.Errorf("truncateLines() with room for every line = %q, want it unchanged", got)
+	}
+
+	want := ".\n├── a.go\n... showing first 2 of 4 lines, use depth to narrow"
+	if got := truncateLines(tree, 2, "use depth to narrow"); got != want {
+		t.Errorf("truncateLines() = %q, want %q", got, want)
+	}
+}
+
+func TestPageOutput_ShortTextBypassesPager(t *testing.T) {
+	calls := stubPager(t, 24)
+
+	PageOutput("a short answer\non two lines")
+	if *calls != 0 {
+		t.Errorf("pager called %d times for short text, want 0", *calls)
+	}
+}
+
+func TestPageOutput_LongTextUsesPager(t *testing.T) {
+	calls := stubPager(t, 24)
+
+	PageOutput(strings.Repeat("line\n", 30))
+	if *calls != 1 {
+		t.Errorf("pager called %d times for long text, want 1", *calls)
+	}
+}
+
+func TestPageOutput_NotATerminal(t *testing.T) {
+	calls := stubPager(t, 0)
+
+	PageOutput(strings.Repeat("line\n", 30))
+	if *calls != 0 {
+		t.Errorf("pager called %d times without a terminal, want 0", *calls)
+	}
+}
+
+func TestPrintWelcome_CustomName(t *testing.T) {
+	var buf bytes.Buffer
+	PrintWelcome(&buf, &Config{
+		AppName: "AcmeSearch",
+		Banner:  "=== Acme internal ===\n",
+		Model:   "gpt-4o",
+		BaseURL: "https://api.openai.com/v1",
+	})
+
+	out := buf.String()
+	for _, want := range []string{"=== Acme internal ===\n", "AcmeSearch " + Version, "Model: gpt-4o | Provider: api.openai.com"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("PrintWelcome output = %q, want it to contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "CodeQuery") {
+		t.Errorf("PrintWelcome output = %q, want the custom name instead of CodeQuery", out)
+	}
+}
+
+func TestPrintWelcome_Default(t *testing.T) {
+	var buf bytes.Buffer
+	PrintWelcome(&buf, &Config{Model: "gpt-4o", BaseURL: "https://api.openai.com/v1"})
+
+	if !strings.Contains(buf.String(), "CodeQuery "+Version) {
+		t.Errorf("PrintWelcome output = %q, want default name and version", buf.String())
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	paragraph := "The config file is loaded from the user directory first and then from the project directory."
+	want := "The config file is loaded from the user\n" +
+		"directory first and then from the\n" +
+		"project directory."
+	if got := WrapText(paragraph, 40); got != want {
+		t.Errorf("WrapText(paragraph, 40) =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, line := range strings.Split(WrapText(paragraph, 40), "\n") {
+		if len(line) > 40 {
+			t.Errorf("wrapped line %q is longer than 40 columns", line)
+		}
+	}
+}
+
+func TestWrapText_PreservesStructure(t *testing.T) {
+	input := "Short line\n\n  - an indented list item that needs wrapping\n```\nfunc veryLongFunctionNameThatStaysIntact() {}\n```"
+	want := "Short line\n\n  - an indented list\n  item that needs\n  wrapping\n```\nfunc veryLongFunctionNameThatStaysIntact() {}\n```"
+	if got := WrapText(input, 20); got != want {
+		t.Errorf("WrapText() =\n%s\nwant\n%s", got, want)
+	}
+	if got := WrapText(input, 0); got != input {
+		t.Errorf("WrapText(width 0) = %q, want input unchanged", got)
+	}
+}
+
+func TestPrintError_NoColor(t *testing.T) {
+	forceColor(t)
+	origOutput := color.Output
+	t.Cleanup(func() { color.Output = origOutput })
+
+	var buf bytes.Buffer
+	color.Output = &buf
+
+	ConfigureColor(false)
+	PrintError("something failed")
+
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("PrintError output = %q, want no escape sequences", buf.String())
+	}
+	if buf.String() != "Error: something failed\n" {
+		t.Errorf("PrintError output = %q, want %q", buf.String(), "Error: something failed\n")
+	}
+}
+
+func TestConfigureColor_NoColorEnv(t *testing.T) {
+	forceColor(t)
+	t.Setenv("NO_COLOR", "1")
+
+	ConfigureColor(true)
+	if !color.NoColor {
+		t.Error("color.NoColor = false with NO_COLOR set, want true")
+	}
+}
+
+func TestToolProgressMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"grep", `{"pattern": "TODO", "path": "src"}`, "Running grep in src..."},
+		{"grep", `{"pattern": "TODO"}`, "Running grep in the current directory..."},
+		{"cat", `{"path": "main.go"}`, "Running cat on main.go..."},
+		{"depends_on", `{"from": "cmd", "to": "internal/db"}`, "Running depends_on on cmd..."},
+		{"which", `{"name": "rg"}`, "Running which..."},
+		{"list_tools", `not json`, "Running list_tools..."},
+	}
+
+	for _, tt := range tests {
+		if got := toolProgressMessage(tt.name, tt.args); got != tt.want {
+			t.Errorf("toolProgressMessage(%s, %s) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPrintDebugStructured(t *testing.T) {
+	var buf bytes.Buffer
+	PrintDebugStructured(&buf, "cat", "{\n  \"path\": \"main.go\"\n}", "package main\n")
+	PrintDebugStructured(&buf, "grep", `not json`, "Error: pattern is required")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want one line per call, got %q", buf.String())
+	}
+
+	var call map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &call); err != nil {
+		t.Fatalf("line is not valid JSON: %v\n%s", err, lines[0])
+	}
+	want := map[string]interface{}{
+		"name":          "cat",
+		"args":          map[string]interface{}{"path": "main.go"},
+		"result_length": float64(len("package main\n")),
+	}
+	if !reflect.DeepEqual(call, want) {
+		t.Errorf("PrintDebugStructured() = %v, want %v", call, want)
+	}
+
+	call = nil
+	if err := json.Unmarshal([]byte(lines[1]), &call); err != nil {
+		t.Fatalf("line is not valid JSON: %v\n%s", err, lines[1])
+	}
+	if call["args"] != "not json" || call["error"] != "pattern is required" || call["result_length"] != float64(0) {
+		t.Errorf("PrintDebugStructured() for a failed call = %v", call)
+	}
+}